@@ -6,15 +6,21 @@ import (
     "net/http"
     "os"
     "os/signal"
+    "sync"
     "syscall"
     "time"
 
     "go.uber.org/zap"
 
     "roleplay/internal/config"
+    "roleplay/internal/controller"
     "roleplay/internal/indexer"
+    "roleplay/internal/migrate"
+    "roleplay/internal/realtime"
     "roleplay/internal/repository"
     "roleplay/internal/router"
+    "roleplay/internal/scheduler"
+    "roleplay/internal/sms"
 )
 
 func main() {
@@ -33,9 +39,39 @@ func main() {
     if err := indexer.EnsureAllIndexes(context.Background()); err != nil {
         zap.L().Fatal("failed to ensure indexes", zap.Error(err))
     }
+    // 数据修复：旧版私聊会话仅记录了首个发送者
+    if err := migrate.BackfillDMParticipants(context.Background()); err != nil {
+        zap.L().Fatal("failed to backfill dm participants", zap.Error(err))
+    }
+
+    if err := sms.Init(); err != nil {
+        zap.L().Fatal("failed to init sms", zap.Error(err))
+    }
 
     r := router.New()
 
+    // 后台任务：定时消息投递、消息保留期清理与历史消息检索索引补建，停机时取消并等待当前一轮结束
+    jobCtx, stopJobs := context.WithCancel(context.Background())
+    var jobs sync.WaitGroup
+    jobs.Add(3)
+    go func() {
+        defer jobs.Done()
+        scheduler.RunScheduledMessages(jobCtx, config.SchedulePollInterval(), controller.DeliverScheduled)
+    }()
+    go func() {
+        defer jobs.Done()
+        scheduler.RunRetention(jobCtx, config.RetentionInterval())
+    }()
+    go func() {
+        defer jobs.Done()
+        migrate.BackfillSearchTokens(jobCtx)
+    }()
+    jobsDone := make(chan struct{})
+    go func() {
+        jobs.Wait()
+        close(jobsDone)
+    }()
+
     srv := &http.Server{
         Addr:              fmt.Sprintf(":%d", config.C.Server.Port),
         Handler:           r,
@@ -58,6 +94,17 @@ func main() {
 
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
+    stopJobs()
+    select {
+    case <-jobsDone:
+    case <-ctx.Done():
+        zap.L().Warn("background jobs did not stop in time")
+    }
+    // 先终止实时订阅：SSE 长请求随之结束，srv.Shutdown 无需等待其超时；
+    // 已升级的 WebSocket 连接不受 srv.Shutdown 管理，同样依赖这里关闭
+    if err := realtime.Shutdown(ctx); err != nil {
+        zap.L().Error("realtime shutdown error", zap.Error(err))
+    }
     if err := srv.Shutdown(ctx); err != nil {
         zap.L().Error("server shutdown error", zap.Error(err))
     }
@@ -0,0 +1,50 @@
+package auth
+
+import (
+    "sync"
+    "time"
+)
+
+// ttlCacheMax 缓存条目达到该数量时清理已过期条目，避免无限增长。
+const ttlCacheMax = 100000
+
+// ttlCache 进程内带过期时间的布尔值缓存，用于减少鉴权中间件的数据库查询。
+type ttlCache struct {
+    mu sync.Mutex
+    m  map[string]ttlCacheEntry
+}
+
+type ttlCacheEntry struct {
+    value   bool
+    expires time.Time
+}
+
+func newTTLCache() *ttlCache {
+    return &ttlCache{m: map[string]ttlCacheEntry{}}
+}
+
+func (c *ttlCache) get(key string) (bool, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    e, ok := c.m[key]
+    if !ok || time.Now().After(e.expires) { return false, false }
+    return e.value, true
+}
+
+func (c *ttlCache) set(key string, value bool, ttl time.Duration) {
+    now := time.Now()
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if len(c.m) >= ttlCacheMax {
+        for k, e := range c.m {
+            if now.After(e.expires) { delete(c.m, k) }
+        }
+    }
+    c.m[key] = ttlCacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+func (c *ttlCache) delete(key string) {
+    c.mu.Lock()
+    delete(c.m, key)
+    c.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+    "context"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// denyCache 令牌ID -> 是否在黑名单中。
+var denyCache = newTTLCache()
+
+// DenyToken 将访问令牌加入黑名单直至其过期，过期后由 TTL 索引清理。
+func DenyToken(ctx context.Context, claims *Claims) error {
+    if claims.ExpiresAt == nil || !claims.ExpiresAt.After(time.Now()) { return nil }
+    _, err := repository.DB().Collection("token_denylist").UpdateOne(ctx,
+        bson.M{"tokenId": claims.ID},
+        bson.M{"$setOnInsert": model.DeniedToken{TokenId: claims.ID, UserId: claims.UserId, CreatedAt: time.Now(), ExpireAt: claims.ExpiresAt.Time}},
+        options.Update().SetUpsert(true),
+    )
+    if err != nil { return err }
+    denyCache.set(claims.ID, true, time.Until(claims.ExpiresAt.Time))
+    return nil
+}
+
+// TokenDenied 判断访问令牌是否在黑名单中；命中的结果缓存至令牌过期，未命中的缓存较短时间。
+func TokenDenied(ctx context.Context, claims *Claims) (bool, error) {
+    if denied, ok := denyCache.get(claims.ID); ok { return denied, nil }
+    err := repository.DB().Collection("token_denylist").FindOne(ctx, bson.M{"tokenId": claims.ID}).Err()
+    if err != nil && err != mongo.ErrNoDocuments { return false, err }
+    denied, ttl := err == nil, sessionCacheTTL
+    if denied && claims.ExpiresAt != nil { ttl = time.Until(claims.ExpiresAt.Time) }
+    denyCache.set(claims.ID, denied, ttl)
+    return denied, nil
+}
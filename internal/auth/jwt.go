@@ -1,6 +1,9 @@
 package auth
 
 import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
     "time"
 
     "github.com/golang-jwt/jwt/v5"
@@ -9,38 +12,57 @@ import (
     "roleplay/internal/config"
 )
 
-// Claims 定义 JWT 自定义负载，包含用户ID。
+// 令牌类型，写入 typ 声明，防止刷新令牌被当作访问令牌使用（反之亦然）。
+const (
+    TokenTypeAccess  = "access"
+    TokenTypeRefresh = "refresh"
+)
+
+// ErrWrongTokenType 令牌类型与用途不符。
+var ErrWrongTokenType = errors.New("wrong token type")
+
+// Claims 自定义 JWT 声明负载，包含用户ID、令牌类型与所属令牌族；jti 为令牌唯一ID。
 type Claims struct {
     UserId string `json:"user_id"`
+    Type   string `json:"typ"`
+    Family string `json:"fam,omitempty"`
     jwt.RegisteredClaims
 }
 
-// GenerateTokens 为给定用户签发访问令牌与刷新令牌。
-func GenerateTokens(userId string) (accessToken string, refreshToken string, err error) {
+// NewTokenId 生成随机令牌ID，也用作令牌族ID。
+func NewTokenId() string {
+    b := make([]byte, 16)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// GenerateAccessToken 为给定用户签发访问令牌，family 为其所属的登录令牌族。
+func GenerateAccessToken(userId, family string) (string, *Claims, error) {
+    return sign(userId, TokenTypeAccess, family, config.AccessTTL())
+}
+
+// GenerateRefreshToken 为给定用户签发刷新令牌，返回的负载用于服务端登记。
+func GenerateRefreshToken(userId, family string) (string, *Claims, error) {
+    return sign(userId, TokenTypeRefresh, family, config.RefreshTTL())
+}
+
+func sign(userId, typ, family string, ttl time.Duration) (string, *Claims, error) {
     now := time.Now()
-    access := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+    claims := &Claims{
         UserId: userId,
+        Type:   typ,
+        Family: family,
         RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(now.Add(config.AccessTTL())),
+            ID:        NewTokenId(),
+            ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
             IssuedAt:  jwt.NewNumericDate(now),
         },
-    })
-    refresh := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-        UserId: userId,
-        RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(now.Add(config.RefreshTTL())),
-            IssuedAt:  jwt.NewNumericDate(now),
-        },
-    })
-    a, err := access.SignedString([]byte(config.C.JWT.Secret))
-    if err != nil {
-        return "", "", err
     }
-    r, err := refresh.SignedString([]byte(config.C.JWT.Secret))
+    s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.C.JWT.Secret))
     if err != nil {
-        return "", "", err
+        return "", nil, err
     }
-    return a, r, nil
+    return s, claims, nil
 }
 
 // ParseToken 校验JWT并返回负载。
@@ -58,3 +80,14 @@ func ParseToken(token string) (*Claims, error) {
     return nil, jwt.ErrTokenInvalidClaims
 }
 
+// ParseTokenOfType 校验JWT并要求其类型为 typ。
+func ParseTokenOfType(token, typ string) (*Claims, error) {
+    claims, err := ParseToken(token)
+    if err != nil {
+        return nil, err
+    }
+    if claims.Type != typ || claims.ID == "" {
+        return nil, ErrWrongTokenType
+    }
+    return claims, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+
+    "roleplay/internal/config"
+)
+
+func withJWTConfig(t *testing.T) {
+    t.Helper()
+    saved := config.C.JWT
+    t.Cleanup(func() { config.C.JWT = saved })
+    config.C.JWT.Secret = "test-secret"
+    config.C.JWT.AccessTTLMin = 15
+    config.C.JWT.RefreshTTLDays = 30
+}
+
+func TestTokenTypeAndFamily(t *testing.T) {
+    withJWTConfig(t)
+    access, ac, err := GenerateAccessToken("u1", "fam1")
+    if err != nil {
+        t.Fatalf("GenerateAccessToken: %v", err)
+    }
+    refresh, rc, err := GenerateRefreshToken("u1", "fam1")
+    if err != nil {
+        t.Fatalf("GenerateRefreshToken: %v", err)
+    }
+    if ac.ID == "" || rc.ID == "" || ac.ID == rc.ID {
+        t.Errorf("jti access=%q refresh=%q, want distinct non-empty ids", ac.ID, rc.ID)
+    }
+
+    got, err := ParseTokenOfType(access, TokenTypeAccess)
+    if err != nil {
+        t.Fatalf("parse access: %v", err)
+    }
+    if got.UserId != "u1" || got.Family != "fam1" || got.Type != TokenTypeAccess || got.ID != ac.ID {
+        t.Errorf("access claims = %+v", got)
+    }
+    if got, err := ParseTokenOfType(refresh, TokenTypeRefresh); err != nil || got.ID != rc.ID {
+        t.Errorf("parse refresh: %+v, %v", got, err)
+    }
+
+    // 刷新令牌不能当访问令牌用，反之亦然
+    if _, err := ParseTokenOfType(refresh, TokenTypeAccess); !errors.Is(err, ErrWrongTokenType) {
+        t.Errorf("refresh as access: err = %v, want ErrWrongTokenType", err)
+    }
+    if _, err := ParseTokenOfType(access, TokenTypeRefresh); !errors.Is(err, ErrWrongTokenType) {
+        t.Errorf("access as refresh: err = %v, want ErrWrongTokenType", err)
+    }
+}
+
+func TestTokenTTL(t *testing.T) {
+    withJWTConfig(t)
+    _, ac, _ := GenerateAccessToken("u1", "fam1")
+    _, rc, _ := GenerateRefreshToken("u1", "fam1")
+    if d := ac.ExpiresAt.Sub(ac.IssuedAt.Time); d != 15*time.Minute {
+        t.Errorf("access ttl = %v, want 15m", d)
+    }
+    if d := rc.ExpiresAt.Sub(rc.IssuedAt.Time); d != 30*24*time.Hour {
+        t.Errorf("refresh ttl = %v, want 720h", d)
+    }
+}
+
+func TestParseTokenRejects(t *testing.T) {
+    withJWTConfig(t)
+    signed := func(claims *Claims, secret string) string {
+        s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return s
+    }
+    valid := func() *Claims {
+        now := time.Now()
+        return &Claims{UserId: "u1", Type: TokenTypeAccess, Family: "fam1", RegisteredClaims: jwt.RegisteredClaims{
+            ID: NewTokenId(), IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+        }}
+    }
+
+    expired := valid()
+    expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+    noJTI := valid()
+    noJTI.ID = ""
+    noType := valid()
+    noType.Type = ""
+    unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+    for name, token := range map[string]string{
+        "wrong secret": signed(valid(), "other-secret"),
+        "expired":      signed(expired, "test-secret"),
+        "missing jti":  signed(noJTI, "test-secret"),
+        "missing typ":  signed(noType, "test-secret"),
+        "alg none":     unsigned,
+        "garbage":      "not.a.jwt",
+    } {
+        if _, err := ParseTokenOfType(token, TokenTypeAccess); err == nil {
+            t.Errorf("%s: token accepted", name)
+        }
+    }
+}
+
+func TestNewTokenId(t *testing.T) {
+    a, b := NewTokenId(), NewTokenId()
+    if len(a) != 32 || a == b {
+        t.Errorf("NewTokenId = %q, %q; want distinct 32-char hex ids", a, b)
+    }
+}
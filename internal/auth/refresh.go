@@ -0,0 +1,82 @@
+package auth
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+var (
+    // ErrRefreshTokenReused 刷新令牌已被使用过，视为泄露，整个令牌族已被吊销。
+    ErrRefreshTokenReused = errors.New("refresh token reused")
+    // ErrInvalidRefreshToken 刷新令牌无效、过期、类型不符、未登记或所属令牌族已被吊销。
+    ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// IssueTokens 在已有令牌族（即登录会话）内签发一对访问令牌与刷新令牌并登记刷新令牌；新登录请使用 StartSession。
+func IssueTokens(ctx context.Context, userId, family string) (accessToken string, refreshToken string, err error) {
+    accessToken, _, err = GenerateAccessToken(userId, family)
+    if err != nil { return "", "", err }
+    refreshToken, claims, err := GenerateRefreshToken(userId, family)
+    if err != nil { return "", "", err }
+    _, err = repository.DB().Collection("refresh_tokens").InsertOne(ctx, model.RefreshToken{
+        TokenId:   claims.ID,
+        UserId:    userId,
+        Family:    family,
+        CreatedAt: claims.IssuedAt.Time,
+        ExpireAt:  claims.ExpiresAt.Time,
+    })
+    if err != nil { return "", "", err }
+    return accessToken, refreshToken, nil
+}
+
+// RotateRefreshToken 校验并消费刷新令牌，在同一令牌族内签发新的一对令牌。
+// 已使用过的刷新令牌再次出现时吊销整个令牌族及其会话并断开其实时推送连接，持有者（无论合法用户还是攻击者）都需重新登录。
+func RotateRefreshToken(ctx context.Context, token string) (accessToken string, refreshToken string, err error) {
+    claims, err := ParseTokenOfType(token, TokenTypeRefresh)
+    if err != nil { return "", "", ErrInvalidRefreshToken }
+    coll := repository.DB().Collection("refresh_tokens")
+    now := time.Now()
+    var rt model.RefreshToken
+    err = coll.FindOneAndUpdate(ctx,
+        bson.M{"tokenId": claims.ID, "usedAt": nil, "revokedAt": nil},
+        bson.M{"$set": bson.M{"usedAt": now}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&rt)
+    if err == mongo.ErrNoDocuments {
+        if err := coll.FindOne(ctx, bson.M{"tokenId": claims.ID}).Decode(&rt); err != nil || rt.RevokedAt != nil {
+            return "", "", ErrInvalidRefreshToken
+        }
+        zap.L().Warn("refresh token reuse detected", zap.String("userId", rt.UserId), zap.String("family", rt.Family))
+        if _, err := RevokeSession(ctx, rt.UserId, rt.Family); err != nil { return "", "", err }
+        // 会话可能已先行吊销（RevokeSession 此时不再处理令牌族），仍需确保令牌族与实时连接被清理
+        if err := RevokeFamily(ctx, rt.Family); err != nil { return "", "", err }
+        return "", "", ErrRefreshTokenReused
+    }
+    if err != nil { return "", "", err }
+    active, err := sessionActive(ctx, rt.Family)
+    if err != nil { return "", "", err }
+    if !active { return "", "", ErrInvalidRefreshToken }
+    if err := touchSession(ctx, rt.Family); err != nil { return "", "", err }
+    return IssueTokens(ctx, rt.UserId, rt.Family)
+}
+
+// RevokeFamily 吊销令牌族下全部刷新令牌，并断开以该令牌族访问令牌建立的实时推送连接。
+func RevokeFamily(ctx context.Context, family string) error {
+    forgetSessions(family)
+    realtime.CloseSessions(family)
+    _, err := repository.DB().Collection("refresh_tokens").UpdateMany(ctx,
+        bson.M{"family": family, "revokedAt": nil},
+        bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+    )
+    return err
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+    "context"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/config"
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+// sessionCacheTTL 会话有效性与令牌黑名单在进程内的缓存时长：本进程吊销立即生效，其它实例最多延迟该时长。
+const sessionCacheTTL = 30 * time.Second
+
+// Device 登录设备信息。
+type Device struct {
+    DeviceId  string
+    Platform  string
+    IP        string
+    UserAgent string
+}
+
+// StartSession 新建登录会话并签发首对令牌，会话ID即令牌族ID。
+func StartSession(ctx context.Context, userId string, dev Device) (accessToken string, refreshToken string, err error) {
+    now := time.Now()
+    sid := NewTokenId()
+    _, err = repository.DB().Collection("sessions").InsertOne(ctx, model.Session{
+        SessionId:    sid,
+        UserId:       userId,
+        DeviceId:     dev.DeviceId,
+        Platform:     dev.Platform,
+        IP:           dev.IP,
+        UserAgent:    dev.UserAgent,
+        CreatedAt:    now,
+        LastActiveAt: now,
+        ExpireAt:     now.Add(config.RefreshTTL()),
+    })
+    if err != nil { return "", "", err }
+    return IssueTokens(ctx, userId, sid)
+}
+
+// sessionCache 会话ID -> 缓存的有效性。
+var sessionCache = newTTLCache()
+
+// CheckSession 判断会话是否有效；缓存未命中时查库并顺带刷新最近活跃时间与IP。
+func CheckSession(ctx context.Context, sid, ip string) (bool, error) {
+    if active, ok := sessionCache.get(sid); ok { return active, nil }
+    err := repository.DB().Collection("sessions").FindOneAndUpdate(ctx,
+        bson.M{"sessionId": sid, "revokedAt": nil},
+        bson.M{"$set": bson.M{"lastActiveAt": time.Now(), "ip": ip}},
+    ).Err()
+    if err != nil && err != mongo.ErrNoDocuments { return false, err }
+    active := err == nil
+    sessionCache.set(sid, active, sessionCacheTTL)
+    return active, nil
+}
+
+// forgetSessions 清除本进程内的会话缓存，使吊销立即生效。
+func forgetSessions(sids ...string) {
+    for _, sid := range sids { sessionCache.delete(sid) }
+}
+
+// sessionActive 直接查库判断会话是否有效（不走缓存），用于刷新令牌旋转。
+func sessionActive(ctx context.Context, sid string) (bool, error) {
+    n, err := repository.DB().Collection("sessions").CountDocuments(ctx, bson.M{"sessionId": sid, "revokedAt": nil})
+    return n > 0, err
+}
+
+// touchSession 刷新令牌旋转后顺延会话过期时间。
+func touchSession(ctx context.Context, sid string) error {
+    now := time.Now()
+    _, err := repository.DB().Collection("sessions").UpdateOne(ctx,
+        bson.M{"sessionId": sid, "revokedAt": nil},
+        bson.M{"$set": bson.M{"lastActiveAt": now, "expireAt": now.Add(config.RefreshTTL())}},
+    )
+    return err
+}
+
+// ListSessions 列出用户未吊销的登录会话，按最近活跃倒序。
+func ListSessions(ctx context.Context, userId string) ([]model.Session, error) {
+    cur, err := repository.DB().Collection("sessions").Find(ctx,
+        bson.M{"userId": userId, "revokedAt": nil},
+        options.Find().SetSort(bson.D{{Key: "lastActiveAt", Value: -1}}),
+    )
+    if err != nil { return nil, err }
+    list := make([]model.Session, 0)
+    if err := cur.All(ctx, &list); err != nil { return nil, err }
+    return list, nil
+}
+
+// RevokeSession 吊销用户的指定会话及其刷新令牌族并断开该会话的实时推送连接，会话不存在或已吊销时返回 false。
+func RevokeSession(ctx context.Context, userId, sid string) (bool, error) {
+    res, err := repository.DB().Collection("sessions").UpdateOne(ctx,
+        bson.M{"sessionId": sid, "userId": userId, "revokedAt": nil},
+        bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+    )
+    if err != nil { return false, err }
+    forgetSessions(sid)
+    realtime.CloseSessions(sid)
+    if res.MatchedCount == 0 { return false, nil }
+    return true, RevokeFamily(ctx, sid)
+}
+
+// RevokeOtherSessions 吊销用户除 keepSid 以外的全部会话，返回吊销数量。
+func RevokeOtherSessions(ctx context.Context, userId, keepSid string) (int, error) {
+    coll := repository.DB().Collection("sessions")
+    filter := bson.M{"userId": userId, "sessionId": bson.M{"$ne": keepSid}, "revokedAt": nil}
+    cur, err := coll.Find(ctx, filter)
+    if err != nil { return 0, err }
+    var list []model.Session
+    if err := cur.All(ctx, &list); err != nil { return 0, err }
+    if len(list) == 0 { return 0, nil }
+    sids := make([]string, 0, len(list))
+    for _, s := range list { sids = append(sids, s.SessionId) }
+    if _, err := coll.UpdateMany(ctx, bson.M{"sessionId": bson.M{"$in": sids}, "revokedAt": nil}, bson.M{"$set": bson.M{"revokedAt": time.Now()}}); err != nil {
+        return 0, err
+    }
+    forgetSessions(sids...)
+    realtime.CloseSessions(sids...)
+    for _, sid := range sids {
+        if err := RevokeFamily(ctx, sid); err != nil { return 0, err }
+    }
+    return len(sids), nil
+}
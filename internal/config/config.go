@@ -11,7 +11,8 @@ var C Config
 
 type Config struct {
     Server struct {
-        Port int `mapstructure:"port"`
+        Port           int      `mapstructure:"port"`
+        TrustedProxies []string `mapstructure:"trusted_proxies"`
     } `mapstructure:"server"`
     JWT struct {
         Secret         string `mapstructure:"secret"`
@@ -24,8 +25,39 @@ type Config struct {
     } `mapstructure:"mongo"`
     SMS struct {
         Enabled  bool   `mapstructure:"enabled"`
+        Provider string `mapstructure:"provider"` // mock 开发联调（固定验证码并回显）/ http 第三方短信网关
         MockCode string `mapstructure:"mock_code"`
+        // 验证码防刷：同一手机号/IP 的发送冷却与 24 小时内发送上限，验证码错误次数上限
+        PhoneCooldownSeconds int `mapstructure:"phone_cooldown_seconds"`
+        PhoneDailyLimit      int `mapstructure:"phone_daily_limit"`
+        IPCooldownSeconds    int `mapstructure:"ip_cooldown_seconds"`
+        IPDailyLimit         int `mapstructure:"ip_daily_limit"`
+        CodeMaxAttempts      int `mapstructure:"code_max_attempts"`
+        HTTP     struct {
+            Endpoint       string `mapstructure:"endpoint"`
+            APIKey         string `mapstructure:"api_key"`
+            SignName       string `mapstructure:"sign_name"`
+            TemplateId     string `mapstructure:"template_id"`
+            TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+        } `mapstructure:"http"`
     } `mapstructure:"sms"`
+    Message struct {
+        RecallWindowSeconds int `mapstructure:"recall_window_seconds"`
+        SchedulePollSeconds int `mapstructure:"schedule_poll_seconds"`
+        ScheduleMaxDays     int `mapstructure:"schedule_max_days"`
+        ScheduleMaxPending  int `mapstructure:"schedule_max_pending"`
+    } `mapstructure:"message"`
+    Retention struct {
+        // 各会话类型消息保留天数，0 表示永久保留
+        DMDays          int    `mapstructure:"dm_days"`
+        GroupDays       int    `mapstructure:"group_days"`
+        RoomDays        int    `mapstructure:"room_days"`
+        Mode            string `mapstructure:"mode"` // archive 移入 messages_archive / delete 直接删除
+        IntervalMinutes int    `mapstructure:"interval_minutes"`
+    } `mapstructure:"retention"`
+    Admin struct {
+        UserIds []string `mapstructure:"user_ids"`
+    } `mapstructure:"admin"`
 }
 
 func Load() error {
@@ -39,6 +71,19 @@ func Load() error {
     v.SetDefault("server.port", 8080)
     v.SetDefault("jwt.access_ttl_minutes", 30)
     v.SetDefault("jwt.refresh_ttl_days", 14)
+    v.SetDefault("sms.provider", "mock")
+    v.SetDefault("sms.http.timeout_seconds", 5)
+    v.SetDefault("sms.phone_cooldown_seconds", 60)
+    v.SetDefault("sms.phone_daily_limit", 10)
+    v.SetDefault("sms.ip_cooldown_seconds", 10)
+    v.SetDefault("sms.ip_daily_limit", 50)
+    v.SetDefault("sms.code_max_attempts", 5)
+    v.SetDefault("message.recall_window_seconds", 120)
+    v.SetDefault("message.schedule_poll_seconds", 5)
+    v.SetDefault("message.schedule_max_days", 30)
+    v.SetDefault("message.schedule_max_pending", 100)
+    v.SetDefault("retention.mode", "archive")
+    v.SetDefault("retention.interval_minutes", 60)
 
     if err := v.ReadInConfig(); err != nil {
         fmt.Printf("warning: using defaults/env, failed to read config: %v\n", err)
@@ -51,4 +96,32 @@ func Load() error {
 
 func AccessTTL() time.Duration { return time.Duration(C.JWT.AccessTTLMin) * time.Minute }
 func RefreshTTL() time.Duration { return time.Duration(C.JWT.RefreshTTLDays) * 24 * time.Hour }
+func SMSTimeout() time.Duration { return time.Duration(C.SMS.HTTP.TimeoutSeconds) * time.Second }
+func RecallWindow() time.Duration { return time.Duration(C.Message.RecallWindowSeconds) * time.Second }
+func SchedulePollInterval() time.Duration { return time.Duration(C.Message.SchedulePollSeconds) * time.Second }
+func ScheduleMaxAhead() time.Duration { return time.Duration(C.Message.ScheduleMaxDays) * 24 * time.Hour }
+func RetentionInterval() time.Duration { return time.Duration(C.Retention.IntervalMinutes) * time.Minute }
+
+// RetentionDays 返回会话类型的消息保留天数，0 表示永久保留。
+func RetentionDays(conversationType string) int {
+    switch conversationType {
+    case "dm":
+        return C.Retention.DMDays
+    case "group":
+        return C.Retention.GroupDays
+    case "room":
+        return C.Retention.RoomDays
+    }
+    return 0
+}
+
+// IsAdmin 判断用户是否为配置中的管理员。
+func IsAdmin(userId string) bool {
+    for _, id := range C.Admin.UserIds {
+        if id == userId {
+            return true
+        }
+    }
+    return false
+}
 
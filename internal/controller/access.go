@@ -0,0 +1,138 @@
+package controller
+
+import (
+    "context"
+    "errors"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.uber.org/zap"
+
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+var (
+    errForbidden           = errors.New("forbidden")
+    errInvalidConversation = errors.New("invalid conversation")
+    // errSendInProgress 同一 client_msg_id 的首次发送尚未完成，重试方稍后再试即可拿到首次结果
+    errSendInProgress = errors.New("message send in progress")
+)
+
+// badRequestError 业务校验失败，错误信息原样返回给客户端（400）。
+type badRequestError string
+
+func (e badRequestError) Error() string { return string(e) }
+
+// authorizeConversation 校验用户对会话的读（write=false）或写权限，返回以存储为准的会话类型：
+// 私聊要求是会话参与者，发言时还需与对方为好友且双方均未拉黑；
+// 群聊要求在 group_members 中；房间要求在 Theater.Participants 中。
+func authorizeConversation(ctx context.Context, userId, conversationType, conversationId string, write bool) (string, error) {
+    db := repository.DB()
+    var conv model.Conversation
+    err := db.Collection("conversations").FindOne(ctx, bson.M{"conversationId": conversationId}).Decode(&conv)
+    exists := err == nil
+    if err != nil && err != mongo.ErrNoDocuments {
+        return "", err
+    }
+    if exists && conv.ConversationType != "" {
+        conversationType = conv.ConversationType
+    }
+
+    switch conversationType {
+    case "group":
+        gid, err := primitive.ObjectIDFromHex(conversationId)
+        if err != nil { return "", errInvalidConversation }
+        n, err := db.Collection("group_members").CountDocuments(ctx, bson.M{"groupId": gid, "userId": userId})
+        if err != nil { return "", err }
+        if n == 0 { return "", errForbidden }
+    case "room":
+        rid, err := primitive.ObjectIDFromHex(conversationId)
+        if err != nil { return "", errInvalidConversation }
+        n, err := db.Collection("theaters").CountDocuments(ctx, bson.M{"_id": rid, "participants.userId": userId})
+        if err != nil { return "", err }
+        if n == 0 { return "", errForbidden }
+    case "dm":
+        // 私聊须先通过 OpenDMConversation 创建，ID 与参与者均由服务端确定
+        if !exists { return "", errForbidden }
+        if !contains(conv.Participants, userId) { return "", errForbidden }
+        if write {
+            for _, peer := range conv.Participants {
+                if peer == userId { continue }
+                ok, err := canMessage(ctx, userId, peer)
+                if err != nil { return "", err }
+                if !ok { return "", errForbidden }
+            }
+        }
+    default:
+        return "", errInvalidConversation
+    }
+    return conversationType, nil
+}
+
+// canMessage 私聊发言条件：双方为好友，且任一方均未拉黑对方。
+func canMessage(ctx context.Context, userId, peer string) (bool, error) {
+    db := repository.DB()
+    a, b := orderPair(userId, peer)
+    n, err := db.Collection("friends").CountDocuments(ctx, bson.M{"userA": a, "userB": b})
+    if err != nil || n == 0 { return false, err }
+    n, err = db.Collection("blocks").CountDocuments(ctx, bson.M{"$or": []bson.M{
+        {"userId": userId, "blockedUserId": peer},
+        {"userId": peer, "blockedUserId": userId},
+    }})
+    if err != nil { return false, err }
+    return n == 0, nil
+}
+
+// requireConversationAccess 在 handler 中执行会话鉴权，失败时已写回响应。
+func requireConversationAccess(c *gin.Context, userId, conversationType, conversationId string, write bool) (string, bool) {
+    t, err := authorizeConversation(c, userId, conversationType, conversationId, write)
+    if err != nil {
+        respondError(c, err)
+        return "", false
+    }
+    return t, true
+}
+
+// groupRole 返回用户在群中的角色（owner/admin/member），不在群中返回 errForbidden。
+func groupRole(ctx context.Context, groupId, userId string) (string, error) {
+    gid, err := primitive.ObjectIDFromHex(groupId)
+    if err != nil { return "", errInvalidConversation }
+    var gm model.GroupMember
+    err = repository.DB().Collection("group_members").FindOne(ctx, bson.M{"groupId": gid, "userId": userId}).Decode(&gm)
+    if err == mongo.ErrNoDocuments { return "", errForbidden }
+    if err != nil { return "", err }
+    return gm.Role, nil
+}
+
+// respondError 将鉴权等业务错误映射为统一响应，未知错误记录日志并返回 500。
+func respondError(c *gin.Context, err error) {
+    var verr *element.ValidationError
+    var berr badRequestError
+    switch {
+    case errors.Is(err, errForbidden):
+        respond(c, http.StatusForbidden, "forbidden", nil)
+    case errors.Is(err, errInvalidConversation):
+        respond(c, http.StatusBadRequest, "invalid conversation", nil)
+    case errors.Is(err, errSendInProgress):
+        respond(c, http.StatusConflict, "message send in progress, retry", nil)
+    case errors.As(err, &verr):
+        respond(c, http.StatusBadRequest, verr.Error(), nil)
+    case errors.As(err, &berr):
+        respond(c, http.StatusBadRequest, berr.Error(), nil)
+    default:
+        zap.L().Error("request failed", zap.String("path", c.FullPath()), zap.Error(err))
+        respond(c, http.StatusInternalServerError, "server error", nil)
+    }
+}
+
+func contains(list []string, v string) bool {
+    for _, s := range list {
+        if s == v { return true }
+    }
+    return false
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,7 +11,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 
-	//"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 
@@ -18,6 +19,7 @@ import (
 	"roleplay/internal/config"
 	"roleplay/internal/model"
 	"roleplay/internal/repository"
+	"roleplay/internal/sms"
 )
 
 var validate = validator.New()
@@ -26,7 +28,7 @@ type sendCodeReq struct {
 	Phone string `json:"phone" validate:"required"`
 }
 
-// SendCode 下发登录验证码（根据配置可为Mock或真实通道）。
+// SendCode 下发登录验证码（根据配置可为Mock或真实通道）；仅 Mock 通道在响应中回显验证码。
 func SendCode(c *gin.Context) {
 	var req sendCodeReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -37,7 +39,27 @@ func SendCode(c *gin.Context) {
 		respond(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
-	code := config.C.SMS.MockCode
+	if !config.C.SMS.Enabled {
+		respond(c, http.StatusServiceUnavailable, "sms disabled", nil)
+		return
+	}
+	// 先占用发送名额再发送：发送失败同样计入频率限制，防止借失败重试绕过
+	retryAfter, err := reserveSendSlot(c, req.Phone, c.ClientIP())
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+		respond(c, http.StatusTooManyRequests, "too many requests", gin.H{"retry_after": int(retryAfter.Seconds())})
+		return
+	}
+	sender := sms.Default()
+	code, err := sms.NewCode(sender)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
 	now := time.Now()
 	ac := model.AuthCode{
 		Phone:     req.Phone,
@@ -46,18 +68,35 @@ func SendCode(c *gin.Context) {
 		CreatedAt: now,
 		ExpireAt:  now.Add(10 * time.Minute),
 	}
-	_, err := repository.DB().Collection("auth_codes").InsertOne(c, ac)
+	res, err := repository.DB().Collection("auth_codes").InsertOne(c, ac)
 	if err != nil {
 		zap.L().Error("insert auth code", zap.Error(err))
 		respond(c, http.StatusInternalServerError, "server error", nil)
 		return
 	}
-	respond(c, http.StatusOK, "success", gin.H{"mock_code": code})
+	if err := sender.Send(c, req.Phone, code); err != nil {
+		// 发送失败则作废刚写入的验证码
+		zap.L().Error("send sms", zap.Error(err))
+		_, _ = repository.DB().Collection("auth_codes").DeleteOne(c, bson.M{"_id": res.InsertedID})
+		respond(c, http.StatusBadGateway, "sms send failed", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", codeResponseData(sender, code))
+}
+
+// codeResponseData 下发验证码成功后的响应数据：仅 Mock 通道回显验证码，真实通道不返回任何内容。
+func codeResponseData(sender sms.Sender, code string) gin.H {
+	if sms.IsMock(sender) {
+		return gin.H{"mock_code": code}
+	}
+	return nil
 }
 
 type loginReq struct {
-	Phone string `json:"phone" validate:"required"`
-	Code  string `json:"code" validate:"required"`
+	Phone    string `json:"phone" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+	DeviceId string `json:"device_id"`
+	Platform string `json:"platform" validate:"omitempty,oneof=android ios web"`
 }
 
 // Login 使用手机号+验证码登录；用户不存在则创建并登录，同时签发令牌。
@@ -71,15 +110,13 @@ func Login(c *gin.Context) {
 		respond(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
-	// Verify code (exists and not expired)
-	var ac model.AuthCode
-	err := repository.DB().Collection("auth_codes").FindOne(c, bson.M{
-		"phone":    req.Phone,
-		"scene":    "login",
-		"code":     req.Code,
-		"expireAt": bson.M{"$gt": time.Now()},
-	}).Decode(&ac)
+	// 校验并消费验证码（最新一条、未过期、未使用、未超过错误次数）
+	ok, err := verifyAuthCode(c, req.Phone, "login", req.Code)
 	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if !ok {
 		respond(c, http.StatusUnauthorized, "invalid code", nil)
 		return
 	}
@@ -111,7 +148,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	access, refresh, err := auth.GenerateTokens(u.UserId)
+	access, refresh, err := auth.StartSession(c, u.UserId, loginDevice(c, req.DeviceId, req.Platform))
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "token error", nil)
 		return
@@ -128,13 +165,16 @@ func RefreshToken(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid request", nil)
 		return
 	}
-	claims, err := auth.ParseToken(body.RefreshToken)
-	if err != nil {
+	// 刷新令牌一次性使用：旋转后旧令牌作废，重复使用会吊销整个令牌族
+	access, refresh, err := auth.RotateRefreshToken(c, body.RefreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		respond(c, http.StatusUnauthorized, "refresh token reused, please login again", nil)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
 		respond(c, http.StatusUnauthorized, "invalid refresh token", nil)
 		return
 	}
-	// 过期校验由 ParseToken 完成。此处仅旋转新对
-	access, refresh, err := auth.GenerateTokens(claims.UserId)
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "token error", nil)
 		return
@@ -197,7 +237,7 @@ func OneClickLogin(c *gin.Context) {
 	}
 
 	// 生成令牌
-	access, refresh, err := auth.GenerateTokens(u.UserId)
+	access, refresh, err := auth.StartSession(c, u.UserId, loginDevice(c, req.DeviceId, req.Platform))
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "token error", nil)
 		return
@@ -206,6 +246,210 @@ func OneClickLogin(c *gin.Context) {
 	respond(c, http.StatusOK, "success", gin.H{"accessToken": access, "refreshToken": refresh})
 }
 
+// sendLimitWindow 发送上限的统计窗口
+const sendLimitWindow = 24 * time.Hour
+
+// sendLimitRule 单个维度（手机号或IP）的发送限制。
+type sendLimitRule struct {
+	key      string
+	cooldown time.Duration
+	daily    int
+}
+
+// sendLimitRules 按配置生成手机号与IP的限制规则，冷却与上限均未配置的维度不做限制。
+func sendLimitRules(phone, ip string) []sendLimitRule {
+	cfg := config.C.SMS
+	var rules []sendLimitRule
+	for _, r := range []sendLimitRule{
+		{"phone:" + phone, time.Duration(cfg.PhoneCooldownSeconds) * time.Second, cfg.PhoneDailyLimit},
+		{"ip:" + ip, time.Duration(cfg.IPCooldownSeconds) * time.Second, cfg.IPDailyLimit},
+	} {
+		if r.cooldown > 0 || r.daily > 0 {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// reserveSendSlot 依次原子地占用手机号与IP的发送名额，超限时返回需等待的时长。
+// IP 超限时归还已占用的手机号名额，避免同一手机号被他人的 IP 限制连带消耗。
+func reserveSendSlot(c *gin.Context, phone, ip string) (time.Duration, error) {
+	now := time.Now()
+	type taken struct {
+		key    string
+		before *model.SMSSendLimit
+	}
+	var held []taken
+	release := func() {
+		for _, t := range held {
+			releaseSendSlot(c, t.key, now, t.before)
+		}
+	}
+	for _, r := range sendLimitRules(phone, ip) {
+		before, wait, err := takeSendSlot(c, r, now)
+		if err != nil || wait > 0 {
+			release()
+			return wait, err
+		}
+		held = append(held, taken{r.key, before})
+	}
+	return 0, nil
+}
+
+// takeSendSlot 以单条条件 upsert 占用名额：冷却已过且窗口未满（或窗口已过期）才会命中并计数；
+// 不满足条件时 upsert 在 _id 上冲突，据现有计数计算等待时长。返回占用前的计数文档（首次发送为 nil）。
+func takeSendSlot(c *gin.Context, r sendLimitRule, now time.Time) (*model.SMSSendLimit, time.Duration, error) {
+	coll := repository.DB().Collection("sms_send_limits")
+	for attempt := 0; ; attempt++ {
+		before, taken, err := upsertSendSlot(c, r, now)
+		if err != nil || taken {
+			return before, 0, err
+		}
+		var cur model.SMSSendLimit
+		err = coll.FindOne(c, bson.M{"_id": r.key}).Decode(&cur)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, 0, err
+		}
+		if err == nil {
+			if wait := sendSlotWait(cur, r, now); wait > 0 {
+				return nil, wait, nil
+			}
+		}
+		// 冲突但计数未超限：并发的首次发送互相冲突或计数刚被清理，重试一次
+		if attempt > 0 {
+			return nil, time.Second, nil
+		}
+	}
+}
+
+// upsertSendSlot 执行一次条件 upsert，taken 为 false 表示条件不满足（在 _id 上冲突）。
+func upsertSendSlot(c *gin.Context, r sendLimitRule, now time.Time) (before *model.SMSSendLimit, taken bool, err error) {
+	filter := bson.M{"_id": r.key}
+	var and []bson.M
+	if r.cooldown > 0 {
+		and = append(and, bson.M{"$or": []bson.M{{"lastSentAt": bson.M{"$lte": now.Add(-r.cooldown)}}, {"lastSentAt": bson.M{"$exists": false}}}})
+	}
+	if r.daily > 0 {
+		and = append(and, bson.M{"$or": []bson.M{{"windowStart": bson.M{"$lte": now.Add(-sendLimitWindow)}}, {"windowStart": bson.M{"$exists": false}}, {"count": bson.M{"$lt": r.daily}}}})
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	var doc model.SMSSendLimit
+	err = repository.DB().Collection("sms_send_limits").FindOneAndUpdate(c, filter, sendSlotUpdate(now, r.cooldown),
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&doc)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return nil, true, nil
+	case err == nil:
+		return &doc, true, nil
+	case mongo.IsDuplicateKeyError(err):
+		return nil, false, nil
+	}
+	return nil, false, err
+}
+
+// sendSlotUpdate 占用名额的流水线更新：窗口过期（或首次发送）时重置窗口并从 1 计数，否则计数加一。
+func sendSlotUpdate(now time.Time, cooldown time.Duration) mongo.Pipeline {
+	reset := bson.M{"$or": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$windowStart", nil}}, nil}},
+		bson.M{"$lte": bson.A{"$windowStart", now.Add(-sendLimitWindow)}},
+	}}
+	windowEnd := bson.M{"$cond": bson.A{reset, now.Add(sendLimitWindow), bson.M{"$add": bson.A{"$windowStart", sendLimitWindow.Milliseconds()}}}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"windowStart": bson.M{"$cond": bson.A{reset, now, "$windowStart"}},
+		"count":       bson.M{"$cond": bson.A{reset, 1, bson.M{"$add": bson.A{"$count", 1}}}},
+		"lastSentAt":  now,
+		// 计数在窗口结束与冷却结束中较晚者之后才可清理
+		"expireAt": bson.M{"$max": bson.A{windowEnd, now.Add(cooldown)}},
+	}}}}
+}
+
+// sendSlotWait 根据当前计数计算还需等待的时长：0 表示未超限，不足一秒按一秒计。
+func sendSlotWait(cur model.SMSSendLimit, r sendLimitRule, now time.Time) time.Duration {
+	var wait time.Duration
+	if r.cooldown > 0 {
+		if d := cur.LastSentAt.Add(r.cooldown).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if r.daily > 0 && cur.Count >= r.daily {
+		if d := cur.WindowStart.Add(sendLimitWindow).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 && wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// releaseSendSlot 归还本次占用的名额：仅当计数仍是本次写入的状态时恢复为占用前的文档。
+func releaseSendSlot(c *gin.Context, key string, now time.Time, before *model.SMSSendLimit) {
+	coll := repository.DB().Collection("sms_send_limits")
+	filter := bson.M{"_id": key, "lastSentAt": now}
+	var err error
+	if before == nil {
+		_, err = coll.DeleteOne(c, filter)
+	} else {
+		_, err = coll.ReplaceOne(c, filter, before)
+	}
+	if err != nil {
+		zap.L().Warn("release sms send slot", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// verifyAuthCode 校验手机号最新一条验证码：输错累加失败次数，达到上限即作废；校验通过后标记已使用，不可再次使用。
+// 比对、计数与标记在一次原子更新中完成，并发猜测不会超过上限，正确的验证码也不会计入失败次数。
+func verifyAuthCode(c *gin.Context, phone, scene, code string) (bool, error) {
+	coll := repository.DB().Collection("auth_codes")
+	now := time.Now()
+	var ac model.AuthCode
+	err := coll.FindOne(c,
+		bson.M{"phone": phone, "scene": scene, "usedAt": nil, "expireAt": bson.M{"$gt": now}},
+		options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	).Decode(&ac)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	maxAttempts := config.C.SMS.CodeMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	var after model.AuthCode
+	err = coll.FindOneAndUpdate(c,
+		bson.M{"_id": ac.ID, "usedAt": nil, "expireAt": bson.M{"$gt": now}, "failedAttempts": bson.M{"$lt": maxAttempts}},
+		verifyCodeUpdate(code, now),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&after)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return after.UsedAt != nil, nil
+}
+
+// verifyCodeUpdate 校验验证码的流水线更新：相符则写入 usedAt，不符则失败次数加一。
+// 用户输入以 $literal 包裹，避免以 "$" 开头的输入被当作字段路径解析。
+func verifyCodeUpdate(code string, now time.Time) mongo.Pipeline {
+	match := bson.M{"$eq": bson.A{"$code", bson.M{"$literal": code}}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failedAttempts": bson.M{"$cond": bson.A{match, "$failedAttempts", bson.M{"$add": bson.A{"$failedAttempts", 1}}}},
+		"usedAt":         bson.M{"$cond": bson.A{match, now, "$$REMOVE"}},
+	}}}}
+}
+
+// loginDevice 汇总本次登录的设备信息，用于会话管理。
+func loginDevice(c *gin.Context, deviceId, platform string) auth.Device {
+	return auth.Device{DeviceId: deviceId, Platform: platform, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
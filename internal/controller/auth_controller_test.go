@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"roleplay/internal/config"
+	"roleplay/internal/model"
+	"roleplay/internal/sms"
+)
+
+func TestCodeResponseData(t *testing.T) {
+	if data := codeResponseData(sms.MockSender{}, "123456"); data["mock_code"] != "123456" {
+		t.Errorf("mock sender: data = %v, want mock_code echoed", data)
+	}
+	if data := codeResponseData(&sms.HTTPSender{}, "123456"); data != nil {
+		t.Errorf("http sender: data = %v, want nil", data)
+	}
+}
+
+func TestSendLimitRules(t *testing.T) {
+	saved := config.C.SMS
+	t.Cleanup(func() { config.C.SMS = saved })
+	config.C.SMS.PhoneCooldownSeconds = 60
+	config.C.SMS.PhoneDailyLimit = 10
+	config.C.SMS.IPCooldownSeconds = 0
+	config.C.SMS.IPDailyLimit = 0
+	want := []sendLimitRule{{"phone:13800000000", time.Minute, 10}}
+	if got := sendLimitRules("13800000000", "10.0.0.1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %+v, want %+v", got, want)
+	}
+	config.C.SMS.IPDailyLimit = 20
+	got := sendLimitRules("13800000000", "10.0.0.1")
+	if len(got) != 2 || got[1] != (sendLimitRule{"ip:10.0.0.1", 0, 20}) {
+		t.Errorf("rules = %+v, want phone and ip rules", got)
+	}
+}
+
+func TestSendSlotWait(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	rule := sendLimitRule{key: "phone:1", cooldown: time.Minute, daily: 3}
+	cases := []struct {
+		name string
+		cur  model.SMSSendLimit
+		want time.Duration
+	}{
+		{"cooldown passed, under limit", model.SMSSendLimit{LastSentAt: now.Add(-2 * time.Minute), WindowStart: now.Add(-time.Hour), Count: 1}, 0},
+		{"in cooldown", model.SMSSendLimit{LastSentAt: now.Add(-20 * time.Second), WindowStart: now.Add(-time.Hour), Count: 1}, 40 * time.Second},
+		{"cooldown almost over rounds up", model.SMSSendLimit{LastSentAt: now.Add(-time.Minute + time.Millisecond), WindowStart: now, Count: 1}, time.Second},
+		{"daily limit reached", model.SMSSendLimit{LastSentAt: now.Add(-time.Hour), WindowStart: now.Add(-20 * time.Hour), Count: 3}, 4 * time.Hour},
+		{"window expired", model.SMSSendLimit{LastSentAt: now.Add(-time.Hour), WindowStart: now.Add(-25 * time.Hour), Count: 3}, 0},
+		{"longer of both", model.SMSSendLimit{LastSentAt: now.Add(-10 * time.Second), WindowStart: now.Add(-24*time.Hour + 30*time.Second), Count: 3}, 50 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := sendSlotWait(tc.cur, rule, now); got != tc.want {
+			t.Errorf("%s: wait = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyCodeUpdateLiteral(t *testing.T) {
+	// 以 "$" 开头的输入若未经 $literal 包裹会被解析为字段路径，"$code" 将与任意验证码相等
+	pipeline := verifyCodeUpdate("$code", time.Now())
+	set := pipeline[0][0].Value.(bson.M)
+	cond := set["usedAt"].(bson.M)["$cond"].(bson.A)
+	eq := cond[0].(bson.M)["$eq"].(bson.A)
+	if eq[0] != "$code" || !reflect.DeepEqual(eq[1], bson.M{"$literal": "$code"}) {
+		t.Errorf("match expression = %v, want user input wrapped in $literal", eq)
+	}
+	if !reflect.DeepEqual(set["failedAttempts"].(bson.M)["$cond"].(bson.A)[0], cond[0]) {
+		t.Error("failedAttempts and usedAt use different match expressions")
+	}
+}
@@ -0,0 +1,393 @@
+package controller
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+// conversationItem 会话列表项：会话摘要 + 当前用户的未读数 + 对端/群/房间元信息。
+type conversationItem struct {
+    model.Conversation
+    ReadSeq      int64 `json:"read_seq"`
+    UnreadCount  int64 `json:"unread_count"`
+    MentionCount int64 `json:"mention_count"` // 未读 @我 的消息数
+    conversationSettings
+    Peer         gin.H `json:"peer,omitempty"`
+    Group        gin.H `json:"group,omitempty"`
+    Room         gin.H `json:"room,omitempty"`
+}
+
+// ListConversations 会话列表，按 updatedAt 倒序游标分页，附带未读数与个人设置；
+// archived=1 只看已归档，archived=0 排除已归档，缺省返回全部。
+// 置顶的会话不参与分页，在首页（无 cursor）的 pinned_conversations 中一次性返回。
+func ListConversations(c *gin.Context) {
+    userId := c.GetString("userId")
+    var limit int64 = 20
+    fmt.Sscan(c.DefaultQuery("limit", "20"), &limit)
+    if limit <= 0 || limit > 100 { limit = 20 }
+
+    ids, err := myConversationIds(c, userId)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if a := c.Query("archived"); a != "" {
+        cur, err := repository.DB().Collection("user_conversations").Find(c, bson.M{"userId": userId, "archived": true})
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        var archived []model.UserConversation
+        if err := cur.All(c, &archived); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        set := make(map[string]bool, len(archived))
+        for _, st := range archived { set[st.ConversationId] = true }
+        kept := ids[:0]
+        for _, id := range ids {
+            if set[id] == (a == "1" || a == "true") { kept = append(kept, id) }
+        }
+        ids = kept
+    }
+    pinnedIds, err := pinnedConversationIds(c, userId, ids)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    filter := bson.M{"conversationId": bson.M{"$in": ids, "$nin": pinnedIds}}
+    // cursor 为上一页最后一条的 "<updatedAt 毫秒时间戳>_<_id>"，同一时间戳的会话以 _id 区分，不会被跳过
+    if cursor := c.Query("cursor"); cursor != "" {
+        t, oid, ok := parseConversationCursor(cursor)
+        if !ok { respond(c, http.StatusBadRequest, "invalid cursor", nil); return }
+        filter["$or"] = []bson.M{{"updatedAt": bson.M{"$lt": t}}, {"updatedAt": t, "_id": bson.M{"$lt": oid}}}
+    }
+    opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+    cur, err := repository.DB().Collection("conversations").Find(c, filter, opts)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    var convs []model.Conversation
+    if err := cur.All(c, &convs); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+
+    items, err := buildConversationItems(c, userId, convs)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    data := gin.H{"conversations": items}
+    // 置顶会话不参与分页：默认仅首页返回，翻页时可以 include_pinned=1 一并取回（如下拉刷新后续页）
+    includePinned := c.Query("cursor") == ""
+    if v := c.Query("include_pinned"); v != "" { includePinned = v == "1" || v == "true" }
+    if includePinned {
+        pinned := []conversationItem{}
+        if len(pinnedIds) > 0 {
+            cur, err := repository.DB().Collection("conversations").Find(c, bson.M{"conversationId": bson.M{"$in": pinnedIds}}, options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}))
+            if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+            var pinnedConvs []model.Conversation
+            if err := cur.All(c, &pinnedConvs); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+            if pinned, err = buildConversationItems(c, userId, pinnedConvs); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        }
+        data["pinned_conversations"] = pinned
+    }
+    next := ""
+    if int64(len(convs)) == limit {
+        last := convs[len(convs)-1]
+        next = strconv.FormatInt(last.UpdatedAt.UnixMilli(), 10) + "_" + last.ID.Hex()
+    }
+    data["next_cursor"] = next
+    respond(c, http.StatusOK, "success", data)
+}
+
+// parseConversationCursor 解析会话列表游标 "<updatedAt 毫秒时间戳>_<_id>"，两部分缺一不可。
+func parseConversationCursor(cursor string) (time.Time, primitive.ObjectID, bool) {
+    msPart, idPart, found := strings.Cut(cursor, "_")
+    if !found { return time.Time{}, primitive.NilObjectID, false }
+    ms, err := strconv.ParseInt(msPart, 10, 64)
+    if err != nil { return time.Time{}, primitive.NilObjectID, false }
+    oid, err := primitive.ObjectIDFromHex(idPart)
+    if err != nil { return time.Time{}, primitive.NilObjectID, false }
+    return time.UnixMilli(ms), oid, true
+}
+
+// pinnedConversationIds 返回 ids 中被用户置顶的会话。
+func pinnedConversationIds(ctx context.Context, userId string, ids []string) ([]string, error) {
+    pinned := []string{}
+    if len(ids) == 0 { return pinned, nil }
+    cur, err := repository.DB().Collection("user_conversations").Find(ctx, bson.M{"userId": userId, "conversationId": bson.M{"$in": ids}, "pinned": true})
+    if err != nil { return nil, err }
+    var list []model.UserConversation
+    if err := cur.All(ctx, &list); err != nil { return nil, err }
+    for _, st := range list { pinned = append(pinned, st.ConversationId) }
+    return pinned, nil
+}
+
+// OpenDMConversation 打开与指定用户的私聊：已存在则直接返回，否则以规范ID创建并写入双方为参与者。
+func OpenDMConversation(c *gin.Context) {
+    userId := c.GetString("userId")
+    var body struct {
+        UserId string `json:"user_id"`
+    }
+    if err := c.ShouldBindJSON(&body); err != nil || body.UserId == "" {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if body.UserId == userId { respond(c, http.StatusBadRequest, "cannot chat with self", nil); return }
+    db := repository.DB()
+    convId := dmConversationId(userId, body.UserId)
+    var conv model.Conversation
+    err := db.Collection("conversations").FindOne(c, bson.M{"conversationId": convId}).Decode(&conv)
+    if err == nil {
+        respond(c, http.StatusOK, "success", conv)
+        return
+    }
+    if err != mongo.ErrNoDocuments { respond(c, http.StatusInternalServerError, "server error", nil); return }
+
+    if n, err := db.Collection("users").CountDocuments(c, bson.M{"userId": body.UserId}); err != nil || n == 0 {
+        respond(c, http.StatusNotFound, "user not found", nil)
+        return
+    }
+    ok, err := canMessage(c, userId, body.UserId)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if !ok { respond(c, http.StatusForbidden, "forbidden", nil); return }
+
+    a, b := orderPair(userId, body.UserId)
+    upsert := true
+    after := options.After
+    err = db.Collection("conversations").FindOneAndUpdate(c, bson.M{"conversationId": convId}, bson.M{
+        "$setOnInsert": bson.M{
+            "conversationType": "dm",
+            "participants":     []string{a, b},
+            "lastSeq":          int64(0),
+            "lastMessage":      "",
+            "updatedAt":        time.Now(),
+        },
+    }, &options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after}).Decode(&conv)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", conv)
+}
+
+// dmConversationId 私聊规范ID：与 friends 的 orderPair 一致，双方无论谁发起都得到同一ID。
+func dmConversationId(a, b string) string {
+    a, b = orderPair(a, b)
+    return "dm_" + a + "_" + b
+}
+
+// MarkConversationRead 将会话标记为已读至指定 seq，并向会话成员推送已读回执。
+func MarkConversationRead(c *gin.Context) {
+    userId := c.GetString("userId")
+    var body struct {
+        ConversationId string `json:"conversation_id"`
+        Seq            int64  `json:"seq"`
+    }
+    if err := c.ShouldBindJSON(&body); err != nil || body.ConversationId == "" || body.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    var conv model.Conversation
+    if err := repository.DB().Collection("conversations").FindOne(c, bson.M{"conversationId": body.ConversationId}).Decode(&conv); err != nil {
+        respond(c, http.StatusNotFound, "conversation not found", nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, conv.ConversationType, conv.ConversationId, false); !ok { return }
+    // 不允许越过会话最新消息
+    seq := body.Seq
+    if seq > conv.LastSeq { seq = conv.LastSeq }
+    if err := advanceReadSeq(c, userId, conv.ConversationId, seq); err != nil {
+        respond(c, http.StatusInternalServerError, "server error", nil)
+        return
+    }
+    var st model.UserConversation
+    _ = repository.DB().Collection("user_conversations").FindOne(c, bson.M{"userId": userId, "conversationId": conv.ConversationId}).Decode(&st)
+    receipt := gin.H{"conversation_id": conv.ConversationId, "user_id": userId, "read_seq": st.ReadSeq}
+    publishToConversation(c, conv.ConversationType, conv.ConversationId, realtime.Event{Type: "conversation.read", Data: receipt})
+    respond(c, http.StatusOK, "success", receipt)
+}
+
+// GetReadStatus 私聊已读状态：返回对方已读到的 seq，用于展示“已读/未读”。
+func GetReadStatus(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    if convId == "" { respond(c, http.StatusBadRequest, "missing conversation_id", nil); return }
+    var conv model.Conversation
+    if err := repository.DB().Collection("conversations").FindOne(c, bson.M{"conversationId": convId}).Decode(&conv); err != nil {
+        respond(c, http.StatusNotFound, "conversation not found", nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, conv.ConversationType, conv.ConversationId, false); !ok { return }
+    if conv.ConversationType != "dm" {
+        respond(c, http.StatusBadRequest, "read status is only available for dm", nil)
+        return
+    }
+    peer := dmPeer(conv, userId)
+    states, err := userConversationStates(c, peer, []string{convId})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"conversation_id": convId, "peer_user_id": peer, "peer_read_seq": states[convId].ReadSeq})
+}
+
+// GetReadCount 群聊已读人数：统计已读游标不小于 seq 的成员数（不含消息发送者）。
+func GetReadCount(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    var seq int64
+    fmt.Sscan(c.DefaultQuery("seq", "0"), &seq)
+    if convId == "" || seq <= 0 { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    var msg model.Message
+    if err := repository.DB().Collection("messages").FindOne(c, bson.M{"conversationId": convId, "seq": seq}).Decode(&msg); err != nil {
+        respond(c, http.StatusNotFound, "message not found", nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, msg.ConversationType, convId, false); !ok { return }
+    members, err := conversationMembers(c, msg.ConversationType, convId)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    readers := make([]string, 0, len(members))
+    for _, m := range members {
+        if m != msg.SenderUserId { readers = append(readers, m) }
+    }
+    n, err := repository.DB().Collection("user_conversations").CountDocuments(c, bson.M{
+        "conversationId": convId,
+        "userId":         bson.M{"$in": readers},
+        "readSeq":        bson.M{"$gte": seq},
+    })
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"conversation_id": convId, "seq": seq, "read_count": n, "member_count": len(readers)})
+}
+
+// buildConversationItems 批量补齐已读游标与对端/群/房间元信息。
+func buildConversationItems(ctx context.Context, userId string, convs []model.Conversation) ([]conversationItem, error) {
+    db := repository.DB()
+    convIds := make([]string, 0, len(convs))
+    var peerIds []string
+    var groupIds, roomIds []primitive.ObjectID
+    for _, cv := range convs {
+        convIds = append(convIds, cv.ConversationId)
+        switch cv.ConversationType {
+        case "group":
+            if oid, err := primitive.ObjectIDFromHex(cv.ConversationId); err == nil { groupIds = append(groupIds, oid) }
+        case "room":
+            if oid, err := primitive.ObjectIDFromHex(cv.ConversationId); err == nil { roomIds = append(roomIds, oid) }
+        default:
+            if peer := dmPeer(cv, userId); peer != "" { peerIds = append(peerIds, peer) }
+        }
+    }
+
+    states, err := userConversationStates(ctx, userId, convIds)
+    if err != nil { return nil, err }
+    mentionCounts, err := unreadMentionCounts(ctx, userId, convIds)
+    if err != nil { return nil, err }
+    unreadCounts, err := unreadMessageCounts(ctx, userId, convs, states)
+    if err != nil { return nil, err }
+
+    users := map[string]model.User{}
+    if len(peerIds) > 0 {
+        cur, err := db.Collection("users").Find(ctx, bson.M{"userId": bson.M{"$in": peerIds}})
+        if err != nil { return nil, err }
+        var list []model.User
+        if err := cur.All(ctx, &list); err != nil { return nil, err }
+        for _, u := range list { users[u.UserId] = u }
+    }
+    groups := map[string]model.Group{}
+    if len(groupIds) > 0 {
+        cur, err := db.Collection("groups").Find(ctx, bson.M{"_id": bson.M{"$in": groupIds}})
+        if err != nil { return nil, err }
+        var list []model.Group
+        if err := cur.All(ctx, &list); err != nil { return nil, err }
+        for _, g := range list { groups[g.ID.Hex()] = g }
+    }
+    rooms := map[string]model.Theater{}
+    if len(roomIds) > 0 {
+        cur, err := db.Collection("theaters").Find(ctx, bson.M{"_id": bson.M{"$in": roomIds}})
+        if err != nil { return nil, err }
+        var list []model.Theater
+        if err := cur.All(ctx, &list); err != nil { return nil, err }
+        for _, r := range list { rooms[r.ID.Hex()] = r }
+    }
+
+    items := make([]conversationItem, 0, len(convs))
+    for _, cv := range convs {
+        st := states[cv.ConversationId]
+        item := conversationItem{Conversation: cv, ReadSeq: st.ReadSeq, conversationSettings: settingsOf(st)}
+        item.UnreadCount = unreadCounts[cv.ConversationId]
+        item.MentionCount = mentionCounts[cv.ConversationId]
+        switch cv.ConversationType {
+        case "group":
+            if g, ok := groups[cv.ConversationId]; ok {
+                item.Group = gin.H{"group_id": g.ID.Hex(), "name": g.Name, "avatar": g.Avatar, "owner_id": g.OwnerId}
+            }
+        case "room":
+            if r, ok := rooms[cv.ConversationId]; ok {
+                item.Room = gin.H{"room_id": r.ID.Hex(), "title": r.Title, "subtitle": r.Subtitle, "mode": r.Mode, "status": r.Status}
+            }
+        default:
+            peer := dmPeer(cv, userId)
+            if u, ok := users[peer]; ok {
+                item.Peer = gin.H{"user_id": u.UserId, "nickname": u.Nickname, "avatar": u.Avatar}
+            } else if peer != "" {
+                item.Peer = gin.H{"user_id": peer}
+            }
+        }
+        items = append(items, item)
+    }
+    return items, nil
+}
+
+// unreadMessageCounts 统计各会话已读游标之后对用户可见的未读消息数：不含已撤回、自己删除的消息与自己发出的消息，
+// seq 空洞也不会被计入。只查询 lastSeq 超过已读游标的会话。
+func unreadMessageCounts(ctx context.Context, userId string, convs []model.Conversation, states map[string]model.UserConversation) (map[string]int64, error) {
+    out := make(map[string]int64, len(convs))
+    var ranges []bson.M
+    for _, cv := range convs {
+        readSeq := states[cv.ConversationId].ReadSeq
+        if cv.LastSeq > readSeq {
+            ranges = append(ranges, bson.M{"conversationId": cv.ConversationId, "seq": bson.M{"$gt": readSeq}})
+        }
+    }
+    if len(ranges) == 0 { return out, nil }
+    cur, err := repository.DB().Collection("messages").Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{
+            "$or":          ranges,
+            "deletedAt":    nil,
+            "hiddenFor":    bson.M{"$ne": userId},
+            "senderUserId": bson.M{"$ne": userId},
+        }}},
+        {{Key: "$group", Value: bson.M{"_id": "$conversationId", "count": bson.M{"$sum": 1}}}},
+    })
+    if err != nil { return nil, err }
+    var rows []struct {
+        Id    string `bson:"_id"`
+        Count int64  `bson:"count"`
+    }
+    if err := cur.All(ctx, &rows); err != nil { return nil, err }
+    for _, r := range rows { out[r.Id] = r.Count }
+    return out, nil
+}
+
+// userConversationStates 批量读取用户在各会话中的个人状态，缺失的会话返回零值。
+func userConversationStates(ctx context.Context, userId string, convIds []string) (map[string]model.UserConversation, error) {
+    out := make(map[string]model.UserConversation, len(convIds))
+    if len(convIds) == 0 { return out, nil }
+    cur, err := repository.DB().Collection("user_conversations").Find(ctx, bson.M{"userId": userId, "conversationId": bson.M{"$in": convIds}})
+    if err != nil { return nil, err }
+    var list []model.UserConversation
+    if err := cur.All(ctx, &list); err != nil { return nil, err }
+    for _, st := range list { out[st.ConversationId] = st }
+    return out, nil
+}
+
+// advanceReadSeq 前移用户在会话中的已读游标（只增不减）。
+func advanceReadSeq(ctx context.Context, userId, conversationId string, seq int64) error {
+    _, err := repository.DB().Collection("user_conversations").UpdateOne(ctx,
+        bson.M{"userId": userId, "conversationId": conversationId},
+        bson.M{"$max": bson.M{"readSeq": seq}, "$set": bson.M{"updatedAt": time.Now()}},
+        options.Update().SetUpsert(true),
+    )
+    if err != nil { return err }
+    // 已读游标越过的 @提及不再算未读
+    _, err = repository.DB().Collection("mentions").DeleteMany(ctx, bson.M{"userId": userId, "conversationId": conversationId, "seq": bson.M{"$lte": seq}})
+    return err
+}
+
+// dmPeer 返回私聊中的对方用户ID。
+func dmPeer(cv model.Conversation, userId string) string {
+    for _, p := range cv.Participants {
+        if p != userId { return p }
+    }
+    return ""
+}
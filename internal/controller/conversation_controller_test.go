@@ -0,0 +1,32 @@
+package controller
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseConversationCursor(t *testing.T) {
+    const hex = "65a1b2c3d4e5f60718293a4b"
+    tm, oid, ok := parseConversationCursor("1700000000123_" + hex)
+    if !ok {
+        t.Fatal("valid cursor rejected")
+    }
+    if !tm.Equal(time.UnixMilli(1700000000123)) {
+        t.Errorf("time = %v, want %v", tm, time.UnixMilli(1700000000123))
+    }
+    if oid.Hex() != hex {
+        t.Errorf("id = %s, want %s", oid.Hex(), hex)
+    }
+
+    for _, cursor := range []string{
+        "1700000000123",         // 旧版仅含时间戳的游标已不再支持
+        "1700000000123_",        // 缺少 _id
+        "abc_" + hex,            // 时间戳非数字
+        "1700000000123_nothex",  // _id 非法
+        "_" + hex,               // 缺少时间戳
+    } {
+        if _, _, ok := parseConversationCursor(cursor); ok {
+            t.Errorf("cursor %q accepted, want rejected", cursor)
+        }
+    }
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+// maxPinnedMessages 单个会话最多置顶的消息数。
+const maxPinnedMessages = 10
+
+// conversationSettings 当前用户对会话的个人设置，随会话列表与同步结果返回。
+// SettingsSeq 为用户自己的设置版本号，与会话共享的 eventSeq 无关，其它成员的同步游标不受影响。
+type conversationSettings struct {
+    Muted       bool   `json:"muted"`
+    Pinned      bool   `json:"pinned"`
+    Archived    bool   `json:"archived"`
+    DisplayName string `json:"display_name"`
+    SettingsSeq int64  `json:"settings_seq"`
+}
+
+func settingsOf(st model.UserConversation) conversationSettings {
+    return conversationSettings{Muted: st.Muted, Pinned: st.Pinned, Archived: st.Archived, DisplayName: st.DisplayName, SettingsSeq: st.SettingsSeq}
+}
+
+// UpdateConversationSettings 修改个人会话设置（免打扰/置顶/归档/自定义名称），未传的字段保持不变。
+func UpdateConversationSettings(c *gin.Context) {
+    userId := c.GetString("userId")
+    var body struct {
+        ConversationId string  `json:"conversation_id"`
+        Muted          *bool   `json:"muted"`
+        Pinned         *bool   `json:"pinned"`
+        Archived       *bool   `json:"archived"`
+        DisplayName    *string `json:"display_name"`
+    }
+    if err := c.ShouldBindJSON(&body); err != nil || body.ConversationId == "" {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    set := bson.M{"updatedAt": time.Now()}
+    unset := bson.M{}
+    // 布尔设置取 false 时删除字段，保持文档精简
+    for key, v := range map[string]*bool{"muted": body.Muted, "pinned": body.Pinned, "archived": body.Archived} {
+        if v == nil { continue }
+        if *v { set[key] = true } else { unset[key] = "" }
+    }
+    if body.DisplayName != nil {
+        name := strings.TrimSpace(*body.DisplayName)
+        if utf8.RuneCountInString(name) > 50 { respond(c, http.StatusBadRequest, "display_name too long", nil); return }
+        if name != "" { set["displayName"] = name } else { unset["displayName"] = "" }
+    }
+    if len(set) == 1 && len(unset) == 0 { respond(c, http.StatusBadRequest, "nothing to update", nil); return }
+    if _, ok := requireConversationAccess(c, userId, "", body.ConversationId, false); !ok { return }
+
+    update := bson.M{"$set": set, "$inc": bson.M{"settingsSeq": 1}}
+    if len(unset) > 0 { update["$unset"] = unset }
+    var st model.UserConversation
+    err := repository.DB().Collection("user_conversations").FindOneAndUpdate(c,
+        bson.M{"userId": userId, "conversationId": body.ConversationId}, update,
+        options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+    ).Decode(&st)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    // 只推送给本人的其它设备；离线设备经增量同步按 settings_seq 获取，不占用会话共享的 eventSeq
+    data := gin.H{"conversation_id": body.ConversationId, "settings": settingsOf(st)}
+    realtime.Publish([]string{userId}, realtime.Event{Type: "conversation.settings", Data: data})
+    respond(c, http.StatusOK, "success", data)
+}
+
+// PinMessage 置顶会话中的一条消息：群聊限群主与管理员，私聊双方均可；数量有上限。
+func PinMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    convType, ok := requirePinAccess(c, userId, req.ConversationId)
+    if !ok { return }
+    db := repository.DB()
+    var msg model.Message
+    err := db.Collection("messages").FindOne(c, bson.M{"conversationId": req.ConversationId, "seq": req.Seq}).Decode(&msg)
+    if err == mongo.ErrNoDocuments { respond(c, http.StatusNotFound, "message not found", nil); return }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if msg.DeletedAt != nil { respond(c, http.StatusConflict, "message recalled", nil); return }
+
+    pin := model.PinnedMessage{Seq: req.Seq, PinnedBy: userId, PinnedAt: time.Now()}
+    var conv model.Conversation
+    // 未置顶且未达上限时才追加，条件写入保证并发下不超限
+    err = db.Collection("conversations").FindOneAndUpdate(c,
+        bson.M{"conversationId": req.ConversationId, "pinnedMessages.seq": bson.M{"$ne": req.Seq}, fmt.Sprintf("pinnedMessages.%d", maxPinnedMessages-1): bson.M{"$exists": false}},
+        bson.M{"$push": bson.M{"pinnedMessages": pin}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&conv)
+    if err == mongo.ErrNoDocuments {
+        if err := db.Collection("conversations").FindOne(c, bson.M{"conversationId": req.ConversationId}).Decode(&conv); err != nil {
+            respond(c, http.StatusNotFound, "conversation not found", nil)
+            return
+        }
+        for _, p := range conv.PinnedMessages {
+            if p.Seq == req.Seq { respond(c, http.StatusOK, "success", gin.H{"pinned_messages": conv.PinnedMessages}); return }
+        }
+        respond(c, http.StatusConflict, "too many pinned messages", nil)
+        return
+    }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if _, err := recordMessageEvent(c, convType, &model.MessageEvent{ConversationId: req.ConversationId, Type: "pin", Seq: req.Seq, OperatorId: userId}); err != nil {
+        respond(c, http.StatusInternalServerError, "server error", nil)
+        return
+    }
+    respond(c, http.StatusOK, "success", gin.H{"pinned_messages": conv.PinnedMessages})
+}
+
+// UnpinMessage 取消置顶，权限同 PinMessage。
+func UnpinMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    convType, ok := requirePinAccess(c, userId, req.ConversationId)
+    if !ok { return }
+    var conv model.Conversation
+    err := repository.DB().Collection("conversations").FindOneAndUpdate(c,
+        bson.M{"conversationId": req.ConversationId, "pinnedMessages.seq": req.Seq},
+        bson.M{"$pull": bson.M{"pinnedMessages": bson.M{"seq": req.Seq}}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&conv)
+    if err == mongo.ErrNoDocuments { respond(c, http.StatusNotFound, "message not pinned", nil); return }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if _, err := recordMessageEvent(c, convType, &model.MessageEvent{ConversationId: req.ConversationId, Type: "unpin", Seq: req.Seq, OperatorId: userId}); err != nil {
+        respond(c, http.StatusInternalServerError, "server error", nil)
+        return
+    }
+    respond(c, http.StatusOK, "success", gin.H{"pinned_messages": conv.PinnedMessages})
+}
+
+// ListPinnedMessages 返回会话的置顶消息（按置顶时间倒序），附带消息内容。
+func ListPinnedMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    if convId == "" { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    if _, ok := requireConversationAccess(c, userId, "", convId, false); !ok { return }
+    db := repository.DB()
+    var conv model.Conversation
+    err := db.Collection("conversations").FindOne(c, bson.M{"conversationId": convId}).Decode(&conv)
+    if err != nil && err != mongo.ErrNoDocuments { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    seqs := make([]int64, 0, len(conv.PinnedMessages))
+    for _, p := range conv.PinnedMessages { seqs = append(seqs, p.Seq) }
+    bySeq := map[int64]model.Message{}
+    if len(seqs) > 0 {
+        cur, err := db.Collection("messages").Find(c, bson.M{"conversationId": convId, "seq": bson.M{"$in": seqs}})
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        var list []model.Message
+        if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        for _, m := range list { bySeq[m.Seq] = m }
+    }
+    out := make([]gin.H, 0, len(conv.PinnedMessages))
+    for i := len(conv.PinnedMessages) - 1; i >= 0; i-- {
+        p := conv.PinnedMessages[i]
+        item := gin.H{"seq": p.Seq, "pinned_by": p.PinnedBy, "pinned_at": p.PinnedAt}
+        if m, ok := bySeq[p.Seq]; ok { item["message"] = m }
+        out = append(out, item)
+    }
+    respond(c, http.StatusOK, "success", gin.H{"pinned_messages": out})
+}
+
+// requirePinAccess 校验置顶消息的管理权限，失败时已写回响应。
+func requirePinAccess(c *gin.Context, userId, conversationId string) (string, bool) {
+    convType, ok := requireConversationAccess(c, userId, "", conversationId, false)
+    if !ok { return "", false }
+    if err := canManagePins(c, userId, convType, conversationId); err != nil {
+        respondError(c, err)
+        return "", false
+    }
+    return convType, true
+}
+
+// canManagePins 群聊限群主与管理员，私聊双方均可（读权限已保证是参与者），房间不支持置顶消息。
+func canManagePins(ctx context.Context, userId, convType, conversationId string) error {
+    switch convType {
+    case "group":
+        role, err := groupRole(ctx, conversationId, userId)
+        if err != nil { return err }
+        if role != "owner" && role != "admin" { return errForbidden }
+        return nil
+    case "room":
+        return badRequestError("pinned messages are not supported in rooms")
+    default:
+        return nil
+    }
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.uber.org/zap"
+
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+const (
+    // exportPageSize 导出时每次从数据库读取的消息数
+    exportPageSize = 500
+    // exportWriteDeadline 每页写出的超时，导出耗时可能超过服务器全局 WriteTimeout
+    exportWriteDeadline = 30 * time.Second
+)
+
+// exportItem 导出条目：消息本身 + 展示用的发送者名称。
+type exportItem struct {
+    model.Message
+    SenderName string `json:"sender_name"`
+}
+
+// ExportConversation 导出会话全部消息（format=json|markdown|txt），按 seq 分页读取并流式写出，不整体加载到内存。
+// 仅会话参与者可导出；房间按角色名展示发送者，其它会话按用户昵称展示。
+func ExportConversation(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    if convId == "" { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    format := c.DefaultQuery("format", "json")
+    ext, contentType := "", ""
+    switch format {
+    case "json":
+        ext, contentType = "json", "application/json; charset=utf-8"
+    case "markdown", "md":
+        format, ext, contentType = "markdown", "md", "text/markdown; charset=utf-8"
+    case "txt", "text":
+        format, ext, contentType = "txt", "txt", "text/plain; charset=utf-8"
+    default:
+        respond(c, http.StatusBadRequest, "invalid format", nil)
+        return
+    }
+    convType, ok := requireConversationAccess(c, userId, "", convId, false)
+    if !ok { return }
+    names, err := newSenderNames(c, convType, convId)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+
+    rc := http.NewResponseController(c.Writer)
+    c.Header("Content-Type", contentType)
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation_%s.%s"`, convId, ext))
+    c.Status(http.StatusOK)
+    w := bufio.NewWriterSize(c.Writer, 64*1024)
+    exportedAt := time.Now()
+    // 缓冲写满时会随时落到连接上，因此写超时须在写入每一页之前续期，而不是写完再续期
+    _ = rc.SetWriteDeadline(time.Now().Add(exportWriteDeadline))
+
+    switch format {
+    case "json":
+        head, _ := json.Marshal(gin.H{"conversation_id": convId, "conversation_type": convType, "exported_at": exportedAt})
+        // 去掉结尾的 "}"，接着写 messages 数组
+        w.Write(head[:len(head)-1])
+        w.WriteString(`,"messages":[`)
+    case "markdown":
+        fmt.Fprintf(w, "# 会话记录 %s\n\n> 类型：%s　导出时间：%s\n\n", convId, convType, exportedAt.Format("2006-01-02 15:04:05"))
+    default:
+        fmt.Fprintf(w, "会话记录 %s（%s）导出时间：%s\n\n", convId, convType, exportedAt.Format("2006-01-02 15:04:05"))
+    }
+
+    base := bson.M{"conversationId": convId, "hiddenFor": bson.M{"$ne": userId}}
+    var after int64
+    first := true
+    for {
+        list, more, err := pageMessages(c, base, bson.M{"$gt": after}, true, exportPageSize)
+        if err != nil {
+            // 响应头已发出，只能中断输出
+            zap.L().Error("export conversation", zap.String("conversationId", convId), zap.Error(err))
+            return
+        }
+        _ = rc.SetWriteDeadline(time.Now().Add(exportWriteDeadline))
+        for _, m := range list {
+            after = m.Seq
+            name := names.resolve(c, m)
+            switch format {
+            case "json":
+                b, err := json.Marshal(exportItem{Message: m, SenderName: name})
+                if err != nil { continue }
+                if !first { w.WriteByte(',') }
+                w.Write(b)
+            case "markdown":
+                fmt.Fprintf(w, "**%s** · %s\n\n%s\n\n", name, m.CreatedAt.Format("2006-01-02 15:04:05"), markdownQuote(exportText(m)))
+            default:
+                fmt.Fprintf(w, "[%s] %s: %s\n", m.CreatedAt.Format("2006-01-02 15:04:05"), name, exportText(m))
+            }
+            first = false
+        }
+        if w.Flush() != nil || rc.Flush() != nil { return }
+        if !more { break }
+    }
+    if format == "json" { w.WriteString("]}") }
+    _ = rc.SetWriteDeadline(time.Now().Add(exportWriteDeadline))
+    _ = w.Flush()
+}
+
+// exportText 消息的可读文本：有正文的取正文，否则取摘要（如 [图片]）。
+func exportText(m model.Message) string {
+    if m.DeletedAt != nil { return "[消息已撤回]" }
+    if s := element.Text(m.Element.Type, m.Element.Data); s != "" { return s }
+    return element.Summary(m.Element.Type, m.Element.Data)
+}
+
+// markdownQuote 以引用块输出多行文本。
+func markdownQuote(s string) string {
+    return "> " + strings.ReplaceAll(s, "\n", "\n> ")
+}
+
+// senderNames 导出时的发送者名称解析：房间优先使用消息或参与者的角色名，其余使用用户昵称，结果按用户缓存。
+type senderNames struct {
+    room     bool
+    costumes map[string]string
+    cache    map[string]string
+}
+
+func newSenderNames(ctx context.Context, convType, convId string) (*senderNames, error) {
+    n := &senderNames{room: convType == "room", costumes: map[string]string{}, cache: map[string]string{}}
+    if !n.room { return n, nil }
+    rid, err := primitive.ObjectIDFromHex(convId)
+    if err != nil { return nil, err }
+    var th model.Theater
+    if err := repository.DB().Collection("theaters").FindOne(ctx, bson.M{"_id": rid}).Decode(&th); err != nil { return nil, err }
+    for _, p := range th.Participants {
+        if p.CostumeName != "" { n.costumes[p.UserId] = p.CostumeName }
+    }
+    return n, nil
+}
+
+func (n *senderNames) resolve(ctx context.Context, m model.Message) string {
+    if n.room {
+        if m.CharacterInfo != nil && m.CharacterInfo.Name != "" { return m.CharacterInfo.Name }
+        if name, ok := n.costumes[m.SenderUserId]; ok { return name }
+    }
+    if name, ok := n.cache[m.SenderUserId]; ok { return name }
+    name := m.SenderUserId
+    var u model.User
+    if err := repository.DB().Collection("users").FindOne(ctx, bson.M{"userId": m.SenderUserId}).Decode(&u); err == nil && u.Nickname != "" {
+        name = u.Nickname
+    }
+    n.cache[m.SenderUserId] = name
+    return name
+}
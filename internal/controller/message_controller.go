@@ -1,17 +1,24 @@
 package controller
 
 import (
+    "context"
     "net/http"
     "time"
     "fmt"
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
 
+    "go.uber.org/zap"
+
+    "roleplay/internal/element"
     "roleplay/internal/model"
+    "roleplay/internal/realtime"
     "roleplay/internal/repository"
+    "roleplay/internal/search"
 )
 
 type sendMsgReq struct {
@@ -20,65 +27,278 @@ type sendMsgReq struct {
     MessageType      string                 `json:"message_type"`
     Element          map[string]interface{} `json:"element"`
     CharacterId      string                 `json:"character_id"`
+    ClientMsgId      string                 `json:"client_msg_id"` // 客户端生成的消息ID，用于重试去重
+    ReplyToSeq       int64                  `json:"reply_to_seq"`  // 回复/引用同会话中的某条消息
+    Mentions         []string               `json:"mentions"`      // 被 @ 的用户ID（仅群聊/房间）
+    MentionAll       bool                   `json:"mention_all"`   // @全体成员（仅群主/管理员）
+
+    // 以下字段仅由服务端内部流程（转发）设置
+    forwardedFrom *model.ForwardInfo
+    allowInternal bool // 允许仅限服务端生成的元素类型
 }
 
 // SendMessage 发送消息（统一接口，支持私聊/群聊/房间）。
+// 携带 client_msg_id 的重试请求返回首次发送的消息，不会重复落库。
 func SendMessage(c *gin.Context) {
-    userId := c.GetString("userId")
     var req sendMsgReq
     if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" {
         respond(c, http.StatusBadRequest, "invalid request", nil)
         return
     }
-    seq, err := nextSeq(c, req.ConversationId)
-    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
-    now := time.Now()
+    respondSend(c, req)
+}
+
+// respondSend 执行发送流程并写回响应。
+func respondSend(c *gin.Context, req sendMsgReq) {
+    msg, duplicate, err := deliverMessage(c, c.GetString("userId"), req)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    respond(c, http.StatusOK, "success", gin.H{"seq": msg.Seq, "message": msg, "duplicate": duplicate})
+}
+
+// deliverMessage 发送流水线：鉴权、幂等去重、分配 seq、落库、更新会话摘要与实时推送。
+// duplicate 为 true 表示命中已发送的同一 client_msg_id，返回的是原消息。
+func deliverMessage(ctx context.Context, userId string, req sendMsgReq) (model.Message, bool, error) {
     elemType, _ := req.Element["type"].(string)
+    if err := element.Validate(elemType, req.Element); err != nil { return model.Message{}, false, err }
+    if element.Internal(elemType) && !req.allowInternal {
+        return model.Message{}, false, &element.ValidationError{Type: elemType, Reason: "cannot be sent directly"}
+    }
+    if req.MessageType == "system" && !req.allowInternal { return model.Message{}, false, badRequestError("system messages cannot be sent directly") }
+    convType, err := authorizeConversation(ctx, userId, req.ConversationType, req.ConversationId, true)
+    if err != nil { return model.Message{}, false, err }
+    req.ConversationType = convType
+    if req.ClientMsgId != "" {
+        if orig, err := findByClientMsgId(ctx, userId, req.ConversationId, req.ClientMsgId); err == nil {
+            return orig, true, nil
+        } else if err != mongo.ErrNoDocuments {
+            return model.Message{}, false, err
+        }
+    }
+    var quote *model.MessageQuote
+    if req.ReplyToSeq > 0 {
+        var target model.Message
+        err := repository.DB().Collection("messages").FindOne(ctx, bson.M{"conversationId": req.ConversationId, "seq": req.ReplyToSeq}).Decode(&target)
+        if err == mongo.ErrNoDocuments { return model.Message{}, false, badRequestError("reply target not found") }
+        if err != nil { return model.Message{}, false, err }
+        quote = quoteOf(target)
+    }
+    members, err := conversationMembers(ctx, req.ConversationType, req.ConversationId)
+    if err != nil { return model.Message{}, false, err }
+    mentions, notify, err := resolveMentions(ctx, userId, req.ConversationType, req.ConversationId, members, req.Mentions, req.MentionAll)
+    if err != nil { return model.Message{}, false, err }
+    // 先占用 client_msg_id 再分配 seq，并发重试不会各自消耗一个 seq
+    if req.ClientMsgId != "" {
+        if orig, err := reserveClientMsgId(ctx, userId, req.ConversationId, req.ClientMsgId); err != nil {
+            return model.Message{}, false, err
+        } else if orig != nil {
+            return *orig, true, nil
+        }
+    }
+    seq, err := nextSeq(ctx, req.ConversationId)
+    if err != nil {
+        releaseClientMsgId(ctx, userId, req.ConversationId, req.ClientMsgId)
+        return model.Message{}, false, err
+    }
+    now := time.Now()
     msg := model.Message{
         ConversationId:   req.ConversationId,
         ConversationType: req.ConversationType,
         Seq:              seq,
         SenderUserId:     userId,
+        ClientMsgId:      req.ClientMsgId,
+        ReplyToSeq:       req.ReplyToSeq,
         MessageType:      req.MessageType,
-        Element:          model.MessageElement{Type: elemType, Data: req.Element},
+        Element:          model.MessageElement{Type: elemType, Data: req.Element, Mentions: mentions, MentionAll: req.MentionAll},
+        SearchTokens:     search.Tokens(element.Text(elemType, req.Element)),
+        SearchVersion:    search.Version,
         CreatedAt:        now,
         UpdatedAt:        now,
     }
     if req.MessageType == "character" {
         msg.CharacterInfo = &model.CharacterInfo{CharacterId: req.CharacterId}
     }
-    _, err = repository.DB().Collection("messages").InsertOne(c, msg)
-    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
-    upsertConversation(c, req.ConversationId, req.ConversationType, []string{userId}, seq, summarize(msg))
-    respond(c, http.StatusOK, "success", gin.H{"seq": seq})
+    if req.forwardedFrom != nil {
+        msg.ForwardedFrom = req.forwardedFrom
+        msg.CharacterInfo = req.forwardedFrom.CharacterInfo
+    }
+    res, err := repository.DB().Collection("messages").InsertOne(ctx, msg)
+    if err != nil {
+        // 落库失败：归还 seq（其后已有新分配时无法归还，留下空洞）并释放占用，允许客户端重试
+        rollbackSeq(ctx, req.ConversationId, seq)
+        releaseClientMsgId(ctx, userId, req.ConversationId, req.ClientMsgId)
+        // 占用过期后的迟到重试仍可能在唯一索引上冲突：返回先到的那条
+        if req.ClientMsgId != "" && mongo.IsDuplicateKeyError(err) {
+            if orig, ferr := findByClientMsgId(ctx, userId, req.ConversationId, req.ClientMsgId); ferr == nil {
+                return orig, true, nil
+            }
+        }
+        return model.Message{}, false, err
+    }
+    msg.ID = res.InsertedID.(primitive.ObjectID)
+    msg.Quote = quote
+    update := upsertConversation(ctx, req.ConversationId, req.ConversationType, members, seq, summarize(msg))
+    // 自己发出的消息视为已读，避免计入自身未读数
+    _ = advanceReadSeq(ctx, userId, req.ConversationId, seq)
+    eventId := streamEventId(msg.ConversationId, msg.Seq)
+    realtime.Publish(members, realtime.Event{ID: eventId, Type: "message.new", Data: msg})
+    realtime.Publish(members, realtime.Event{ID: eventId, Type: "conversation.update", Data: update})
+    recordMentions(ctx, msg, notify)
+    return msg, false, nil
+}
+
+// clientMsgReservationTTL client_msg_id 占用的有效期，超过后视为首次发送已中断，重试可重新占用。
+const clientMsgReservationTTL = 2 * time.Minute
+
+func clientMsgReservationId(userId, conversationId, clientMsgId string) string {
+    return conversationId + ":" + userId + ":" + clientMsgId
+}
+
+// reserveClientMsgId 在分配 seq 之前占用 client_msg_id。占用已存在时：原消息已落库则返回原消息，
+// 否则说明首次发送仍在进行，返回 errSendInProgress。
+func reserveClientMsgId(ctx context.Context, userId, conversationId, clientMsgId string) (*model.Message, error) {
+    col := repository.DB().Collection("client_msg_reservations")
+    id := clientMsgReservationId(userId, conversationId, clientMsgId)
+    now := time.Now()
+    // 过期占用由 TTL 索引清理，清理前先就地删除，避免中断的发送长时间阻塞重试
+    if _, err := col.DeleteOne(ctx, bson.M{"_id": id, "expireAt": bson.M{"$lte": now}}); err != nil { return nil, err }
+    _, err := col.InsertOne(ctx, bson.M{"_id": id, "createdAt": now, "expireAt": now.Add(clientMsgReservationTTL)})
+    if err == nil { return nil, nil }
+    if !mongo.IsDuplicateKeyError(err) { return nil, err }
+    orig, err := findByClientMsgId(ctx, userId, conversationId, clientMsgId)
+    if err == mongo.ErrNoDocuments { return nil, errSendInProgress }
+    if err != nil { return nil, err }
+    return &orig, nil
+}
+
+// releaseClientMsgId 发送失败时释放占用，clientMsgId 为空时不做任何事。
+func releaseClientMsgId(ctx context.Context, userId, conversationId, clientMsgId string) {
+    if clientMsgId == "" { return }
+    if _, err := repository.DB().Collection("client_msg_reservations").DeleteOne(ctx, bson.M{"_id": clientMsgReservationId(userId, conversationId, clientMsgId)}); err != nil {
+        zap.L().Warn("release client msg id", zap.String("conversationId", conversationId), zap.Error(err))
+    }
 }
 
-// GetMessageHistory 按 seq 进行分页查询历史消息。
+// rollbackSeq 仅当计数器仍停在 seq（期间无人再分配）时回退一位，避免落库失败留下空洞。
+func rollbackSeq(ctx context.Context, conversationId string, seq int64) {
+    if _, err := repository.DB().Collection("counters").UpdateOne(ctx, bson.M{"_id": conversationId, "seq": seq}, bson.M{"$inc": bson.M{"seq": -1}}); err != nil {
+        zap.L().Warn("rollback seq", zap.String("conversationId", conversationId), zap.Error(err))
+    }
+}
+
+func findByClientMsgId(ctx context.Context, userId, conversationId, clientMsgId string) (model.Message, error) {
+    var msg model.Message
+    err := repository.DB().Collection("messages").FindOne(ctx, bson.M{
+        "conversationId": conversationId,
+        "senderUserId":   userId,
+        "clientMsgId":    clientMsgId,
+    }).Decode(&msg)
+    return msg, err
+}
+
+// GetMessageHistory 按 seq 分页查询历史消息，结果始终按 seq 升序返回。
+// 定位方式（互斥，按优先级）：around=N 以 N 为中心；before=N 向前翻页；after=N（兼容 lastSeq）向后翻页；
+// 均未指定时返回最新的 limit 条。has_more_before / has_more_after 指示两个方向是否还有数据。
 func GetMessageHistory(c *gin.Context) {
+    userId := c.GetString("userId")
     convType := c.Query("conversation_type")
     convId := c.Query("conversation_id")
-    var lastSeq int64
-    fmt.Sscan(c.DefaultQuery("lastSeq", "0"), &lastSeq)
     var limit int64 = 50
     fmt.Sscan(c.DefaultQuery("limit", "50"), &limit)
+    if limit <= 0 || limit > 100 { limit = 50 }
     if convId == "" { respond(c, http.StatusBadRequest, "missing conversation_id", nil); return }
-    filter := bson.M{"conversationId": convId}
-    if lastSeq > 0 {
-        filter["seq"] = bson.M{"$gt": lastSeq}
+    convType, ok := requireConversationAccess(c, userId, convType, convId, false)
+    if !ok { return }
+    // 撤回的消息以墓碑形式保留以维持 seq 连续；仅自己删除的消息对本人隐藏
+    base := bson.M{"conversationId": convId, "hiddenFor": bson.M{"$ne": userId}}
+
+    var (
+        list                        []model.Message
+        hasMoreBefore, hasMoreAfter bool
+        err                         error
+    )
+    switch {
+    case c.Query("around") != "":
+        var anchor int64
+        fmt.Sscan(c.Query("around"), &anchor)
+        older := limit / 2
+        var head, tail []model.Message
+        head, hasMoreBefore, err = pageMessages(c, base, bson.M{"$lt": anchor}, false, older)
+        if err == nil && older == 0 {
+            // limit=1 时不取更早的消息，仍需判断其是否存在
+            hasMoreBefore, err = existsMessage(c, base, bson.M{"$lt": anchor})
+        }
+        if err == nil {
+            tail, hasMoreAfter, err = pageMessages(c, base, bson.M{"$gte": anchor}, true, limit-older)
+        }
+        list = append(head, tail...)
+    case c.Query("before") != "":
+        var before int64
+        fmt.Sscan(c.Query("before"), &before)
+        list, hasMoreBefore, err = pageMessages(c, base, bson.M{"$lt": before}, false, limit)
+        if err == nil {
+            hasMoreAfter, err = existsMessage(c, base, bson.M{"$gte": before})
+        }
+    case c.Query("after") != "" || c.Query("lastSeq") != "":
+        var after int64
+        fmt.Sscan(c.DefaultQuery("after", c.Query("lastSeq")), &after)
+        list, hasMoreAfter, err = pageMessages(c, base, bson.M{"$gt": after}, true, limit)
+        if err == nil {
+            hasMoreBefore, err = existsMessage(c, base, bson.M{"$lte": after})
+        }
+    default:
+        list, hasMoreBefore, err = pageMessages(c, base, nil, false, limit)
     }
-    opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
-    cur, err := repository.DB().Collection("messages").Find(c, filter, opts)
+    if err == nil { err = attachQuotes(c, convId, list) }
+    if err == nil { err = attachReactions(c, userId, convId, list) }
     if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
-    var list []model.Message
-    _ = cur.All(c, &list)
-    respond(c, http.StatusOK, "success", gin.H{"conversation_type": convType, "conversation_id": convId, "messages": list})
+    respond(c, http.StatusOK, "success", gin.H{
+        "conversation_type": convType,
+        "conversation_id":   convId,
+        "messages":          list,
+        "has_more_before":   hasMoreBefore,
+        "has_more_after":    hasMoreAfter,
+    })
 }
 
-func nextSeq(c *gin.Context, conversationId string) (int64, error) {
+// pageMessages 在 seqCond 范围内取 limit 条：asc 为 true 取最小的一端，否则取最大的一端；
+// 返回值按 seq 升序排列，more 表示该方向上还有更多消息。
+func pageMessages(ctx context.Context, base, seqCond bson.M, asc bool, limit int64) (list []model.Message, more bool, err error) {
+    if limit <= 0 { return nil, false, nil }
+    filter := bson.M{}
+    for k, v := range base { filter[k] = v }
+    if seqCond != nil { filter["seq"] = seqCond }
+    dir := 1
+    if !asc { dir = -1 }
+    opts := options.Find().SetSort(bson.D{{Key: "seq", Value: dir}}).SetLimit(limit + 1)
+    cur, err := repository.DB().Collection("messages").Find(ctx, filter, opts)
+    if err != nil { return nil, false, err }
+    if err := cur.All(ctx, &list); err != nil { return nil, false, err }
+    if int64(len(list)) > limit {
+        more = true
+        list = list[:limit]
+    }
+    if !asc {
+        for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 { list[i], list[j] = list[j], list[i] }
+    }
+    return list, more, nil
+}
+
+// existsMessage 判断 seqCond 范围内是否存在对当前用户可见的消息。
+func existsMessage(ctx context.Context, base, seqCond bson.M) (bool, error) {
+    filter := bson.M{"seq": seqCond}
+    for k, v := range base { filter[k] = v }
+    n, err := repository.DB().Collection("messages").CountDocuments(ctx, filter, options.Count().SetLimit(1))
+    return n > 0, err
+}
+
+func nextSeq(ctx context.Context, conversationId string) (int64, error) {
     var res struct{ Seq int64 `bson:"seq"` }
     upsert := true
     after := options.After
-    err := repository.DB().Collection("counters").FindOneAndUpdate(c,
+    err := repository.DB().Collection("counters").FindOneAndUpdate(ctx,
         bson.M{"_id": conversationId},
         bson.M{"$inc": bson.M{"seq": 1}},
         &options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after},
@@ -92,16 +312,102 @@ func nextSeq(c *gin.Context, conversationId string) (int64, error) {
     return res.Seq, nil
 }
 
-func upsertConversation(c *gin.Context, conversationId, conversationType string, participants []string, lastSeq int64, lastMsg string) {
+// conversationUpdate 会话摘要变更，作为 conversation.update 事件推送。
+type conversationUpdate struct {
+    ConversationId   string    `json:"conversation_id"`
+    ConversationType string    `json:"conversation_type"`
+    LastSeq          int64     `json:"last_seq"`
+    LastMessage      string    `json:"last_message"`
+    UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// upsertConversation 更新会话摘要，participants 为发送时解析出的完整成员列表
+// （私聊为双方，群聊/房间为当前成员），随每条消息刷新以反映成员变动。
+func upsertConversation(ctx context.Context, conversationId, conversationType string, participants []string, lastSeq int64, lastMsg string) conversationUpdate {
     now := time.Now()
-    _, _ = repository.DB().Collection("conversations").UpdateOne(c, bson.M{"conversationId": conversationId}, bson.M{
-        "$setOnInsert": bson.M{"participants": participants, "conversationType": conversationType},
-        "$set":        bson.M{"lastSeq": lastSeq, "lastMessage": lastMsg, "updatedAt": now},
+    _, _ = repository.DB().Collection("conversations").UpdateOne(ctx, bson.M{"conversationId": conversationId}, bson.M{
+        "$setOnInsert": bson.M{"conversationType": conversationType},
+        "$set":        bson.M{"participants": participants, "lastSeq": lastSeq, "lastMessage": lastMsg, "updatedAt": now},
     }, options.Update().SetUpsert(true))
+    return conversationUpdate{ConversationId: conversationId, ConversationType: conversationType, LastSeq: lastSeq, LastMessage: lastMsg, UpdatedAt: now}
+}
+
+// conversationMembers 解析会话成员：群聊取 group_members，房间取 Theater.Participants，私聊取会话参与者。
+func conversationMembers(ctx context.Context, conversationType, conversationId string) ([]string, error) {
+    db := repository.DB()
+    switch conversationType {
+    case "group":
+        gid, err := primitive.ObjectIDFromHex(conversationId)
+        if err != nil { return nil, err }
+        cur, err := db.Collection("group_members").Find(ctx, bson.M{"groupId": gid})
+        if err != nil { return nil, err }
+        var members []model.GroupMember
+        if err := cur.All(ctx, &members); err != nil { return nil, err }
+        ids := make([]string, 0, len(members))
+        for _, m := range members { ids = append(ids, m.UserId) }
+        return ids, nil
+    case "room":
+        rid, err := primitive.ObjectIDFromHex(conversationId)
+        if err != nil { return nil, err }
+        var th model.Theater
+        if err := db.Collection("theaters").FindOne(ctx, bson.M{"_id": rid}).Decode(&th); err != nil { return nil, err }
+        ids := make([]string, 0, len(th.Participants))
+        for _, p := range th.Participants { ids = append(ids, p.UserId) }
+        return ids, nil
+    default:
+        var conv model.Conversation
+        if err := db.Collection("conversations").FindOne(ctx, bson.M{"conversationId": conversationId}).Decode(&conv); err != nil { return nil, err }
+        return conv.Participants, nil
+    }
+}
+
+// myConversationIds 列出用户所属的全部会话：参与过的会话、所在群组与已加入的房间。
+func myConversationIds(ctx context.Context, userId string) ([]string, error) {
+    db := repository.DB()
+    seen := map[string]struct{}{}
+    var ids []string
+    add := func(id string) {
+        if _, ok := seen[id]; !ok {
+            seen[id] = struct{}{}
+            ids = append(ids, id)
+        }
+    }
+
+    cur, err := db.Collection("conversations").Find(ctx, bson.M{"participants": userId}, options.Find().SetProjection(bson.M{"conversationId": 1}))
+    if err != nil { return nil, err }
+    var convs []model.Conversation
+    if err := cur.All(ctx, &convs); err != nil { return nil, err }
+    for _, cv := range convs { add(cv.ConversationId) }
+
+    cur, err = db.Collection("group_members").Find(ctx, bson.M{"userId": userId})
+    if err != nil { return nil, err }
+    var members []model.GroupMember
+    if err := cur.All(ctx, &members); err != nil { return nil, err }
+    for _, m := range members { add(m.GroupId.Hex()) }
+
+    cur, err = db.Collection("theaters").Find(ctx, bson.M{"participants.userId": userId}, options.Find().SetProjection(bson.M{"_id": 1}))
+    if err != nil { return nil, err }
+    var rooms []model.Theater
+    if err := cur.All(ctx, &rooms); err != nil { return nil, err }
+    for _, r := range rooms { add(r.ID.Hex()) }
+    return ids, nil
+}
+
+// publishToConversation 将事件推送给会话全部在线成员，推送失败不影响主流程。
+func publishToConversation(ctx context.Context, conversationType, conversationId string, evs ...realtime.Event) {
+    members, err := conversationMembers(ctx, conversationType, conversationId)
+    if err != nil {
+        zap.L().Warn("resolve conversation members", zap.String("conversationId", conversationId), zap.Error(err))
+        return
+    }
+    for _, ev := range evs {
+        realtime.Publish(members, ev)
+    }
 }
 
+// summarize 生成会话列表中的最新消息预览，规则由元素注册表按类型提供。
 func summarize(m model.Message) string {
-    if t, ok := m.Element.Data["text"].(string); ok { return t }
-    return m.Element.Type
+    if m.DeletedAt != nil { return "[消息已撤回]" }
+    return element.Summary(m.Element.Type, m.Element.Data)
 }
 
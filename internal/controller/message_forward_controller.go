@@ -0,0 +1,145 @@
+package controller
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// maxSingleForwards 逐条转发一次最多转发的消息数，更多时应使用合并转发。
+const maxSingleForwards = 20
+
+type forwardReq struct {
+    SourceConversationId   string  `json:"source_conversation_id"`
+    Seqs                   []int64 `json:"seqs"`
+    TargetConversationType string  `json:"target_conversation_type"` // dm|group|room
+    TargetConversationId   string  `json:"target_conversation_id"`
+    Mode                   string  `json:"mode"`  // single 逐条转发（默认）/ merged 合并转发
+    Title                  string  `json:"title"` // 合并转发的聊天记录标题
+    ClientMsgId            string  `json:"client_msg_id"`
+}
+
+// ForwardMessages 将一个会话中的若干消息转发到另一个会话：需要源会话的读权限与目标会话的写权限。
+// 逐条转发时每条消息保留原发送者与角色信息（forwarded_from）；合并转发生成一条 merged_forward 消息。
+// 新消息均经发送流水线分配目标会话中的 seq。
+func ForwardMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req forwardReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.SourceConversationId == "" || req.TargetConversationId == "" || len(req.Seqs) == 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if req.Mode == "" { req.Mode = "single" }
+    switch {
+    case req.Mode != "single" && req.Mode != "merged":
+        respond(c, http.StatusBadRequest, "invalid mode", nil)
+        return
+    case req.Mode == "single" && len(req.Seqs) > maxSingleForwards:
+        respond(c, http.StatusBadRequest, fmt.Sprintf("at most %d messages per single forward, use merged mode", maxSingleForwards), nil)
+        return
+    case len(req.Seqs) > element.MaxForwardItems:
+        respond(c, http.StatusBadRequest, fmt.Sprintf("at most %d messages per forward", element.MaxForwardItems), nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, "", req.SourceConversationId, false); !ok { return }
+    if _, err := authorizeConversation(c, userId, req.TargetConversationType, req.TargetConversationId, true); err != nil { respondError(c, err); return }
+    sources, err := loadForwardSources(c, userId, req.SourceConversationId, req.Seqs)
+    if err != nil { respondError(c, err); return }
+
+    base := sendMsgReq{ConversationType: req.TargetConversationType, ConversationId: req.TargetConversationId}
+    out := make([]model.Message, 0, len(sources))
+    if req.Mode == "merged" {
+        send := base
+        // merged_forward 只能由服务端生成，仅此处放行
+        send.allowInternal = true
+        send.MessageType = "user"
+        send.Element = mergedForwardElement(req.Title, sources)
+        send.ClientMsgId = req.ClientMsgId
+        msg, _, err := deliverMessage(c, userId, send)
+        if err != nil { respondError(c, err); return }
+        out = append(out, msg)
+    } else {
+        for i, m := range sources {
+            send := base
+            send.MessageType = m.MessageType
+            send.Element = copyElement(m.Element)
+            // 已有的聊天记录可原样再转发；系统提示已在 loadForwardSources 中拒绝
+            send.allowInternal = m.Element.Type == "merged_forward"
+            if req.ClientMsgId != "" { send.ClientMsgId = fmt.Sprintf("%s:%d", req.ClientMsgId, i) }
+            send.forwardedFrom = &model.ForwardInfo{ConversationId: m.ConversationId, Seq: m.Seq, SenderUserId: m.SenderUserId, CharacterInfo: m.CharacterInfo, CreatedAt: m.CreatedAt}
+            // 已转发出的消息不回滚，失败时返回错误，客户端可携带同一 client_msg_id 重试
+            msg, _, err := deliverMessage(c, userId, send)
+            if err != nil { respondError(c, err); return }
+            out = append(out, msg)
+        }
+    }
+    respond(c, http.StatusOK, "success", gin.H{"messages": out})
+}
+
+// loadForwardSources 按 seq 升序读取待转发的消息；已撤回、已对自己隐藏、不存在的消息或系统消息使整个请求失败。
+func loadForwardSources(ctx context.Context, userId, conversationId string, seqs []int64) ([]model.Message, error) {
+    uniq := make([]int64, 0, len(seqs))
+    seen := make(map[int64]bool, len(seqs))
+    for _, s := range seqs {
+        if s > 0 && !seen[s] { seen[s] = true; uniq = append(uniq, s) }
+    }
+    filter := bson.M{"conversationId": conversationId, "seq": bson.M{"$in": uniq}, "deletedAt": nil, "hiddenFor": bson.M{"$ne": userId}}
+    cur, err := repository.DB().Collection("messages").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+    if err != nil { return nil, err }
+    var list []model.Message
+    if err := cur.All(ctx, &list); err != nil { return nil, err }
+    if len(list) == 0 || len(list) != len(uniq) { return nil, badRequestError("some messages are unavailable for forwarding") }
+    for _, m := range list {
+        if !forwardable(m) { return nil, badRequestError("system messages cannot be forwarded") }
+    }
+    return list, nil
+}
+
+// forwardable 系统消息（system 类型或 system 元素）由服务端生成，转发出去会伪装成目标会话的系统通知，不允许转发。
+func forwardable(m model.Message) bool {
+    return m.MessageType != "system" && m.Element.Type != "system"
+}
+
+// mergedForwardElement 将多条消息打包为 merged_forward 元素，条目保留原发送者、角色信息与元素内容。
+func mergedForwardElement(title string, sources []model.Message) map[string]interface{} {
+    items := make([]interface{}, 0, len(sources))
+    for _, m := range sources {
+        item := map[string]interface{}{
+            "seq":            m.Seq,
+            "sender_user_id": m.SenderUserId,
+            "message_type":   m.MessageType,
+            "element":        copyElement(m.Element),
+            "created_at":     m.CreatedAt,
+        }
+        if m.CharacterInfo != nil {
+            item["character_info"] = map[string]interface{}{
+                "character_id": m.CharacterInfo.CharacterId,
+                "name":         m.CharacterInfo.Name,
+                "avatar":       m.CharacterInfo.Avatar,
+            }
+        }
+        items = append(items, item)
+    }
+    return map[string]interface{}{
+        "type":                   "merged_forward",
+        "title":                  title,
+        "source_conversation_id": sources[0].ConversationId,
+        "items":                  items,
+    }
+}
+
+// copyElement 复制元素数据，确保 type 字段与元素类型一致。
+func copyElement(e model.MessageElement) map[string]interface{} {
+    out := make(map[string]interface{}, len(e.Data)+1)
+    for k, v := range e.Data { out[k] = v }
+    out["type"] = e.Type
+    return out
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+    "testing"
+
+    "roleplay/internal/model"
+)
+
+func TestForwardable(t *testing.T) {
+    cases := []struct {
+        name string
+        msg  model.Message
+        want bool
+    }{
+        {"user text", model.Message{MessageType: "user", Element: model.MessageElement{Type: "text"}}, true},
+        {"character text", model.Message{MessageType: "character", Element: model.MessageElement{Type: "text"}}, true},
+        {"merged record", model.Message{MessageType: "user", Element: model.MessageElement{Type: "merged_forward"}}, true},
+        {"system element", model.Message{MessageType: "user", Element: model.MessageElement{Type: "system"}}, false},
+        {"system message type", model.Message{MessageType: "system", Element: model.MessageElement{Type: "text"}}, false},
+    }
+    for _, tc := range cases {
+        if got := forwardable(tc.msg); got != tc.want {
+            t.Errorf("%s: forwardable = %v, want %v", tc.name, got, tc.want)
+        }
+    }
+}
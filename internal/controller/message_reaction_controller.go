@@ -0,0 +1,111 @@
+package controller
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// maxEmojiLen 表情最大字符数（组合 emoji 可能由多个码点组成）。
+const maxEmojiLen = 16
+
+type reactionReq struct {
+    messageRefReq
+    Emoji string `json:"emoji"`
+}
+
+// AddReaction 为消息添加表情回应：会话成员均可操作，重复添加同一表情视为成功且不产生事件。
+func AddReaction(c *gin.Context) {
+    changeReaction(c, "add")
+}
+
+// RemoveReaction 取消自己在消息上的某个表情回应。
+func RemoveReaction(c *gin.Context) {
+    changeReaction(c, "remove")
+}
+
+func changeReaction(c *gin.Context, action string) {
+    userId := c.GetString("userId")
+    var req reactionReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    req.Emoji = strings.TrimSpace(req.Emoji)
+    if req.Emoji == "" || utf8.RuneCountInString(req.Emoji) > maxEmojiLen || strings.ContainsAny(req.Emoji, " \t\r\n") {
+        respond(c, http.StatusBadRequest, "invalid emoji", nil)
+        return
+    }
+    convType, ok := requireConversationAccess(c, userId, "", req.ConversationId, false)
+    if !ok { return }
+    var msg model.Message
+    err := repository.DB().Collection("messages").FindOne(c, bson.M{"conversationId": req.ConversationId, "seq": req.Seq, "hiddenFor": bson.M{"$ne": userId}}).Decode(&msg)
+    if err == mongo.ErrNoDocuments { respond(c, http.StatusNotFound, "message not found", nil); return }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+
+    coll := repository.DB().Collection("message_reactions")
+    key := bson.M{"conversationId": req.ConversationId, "seq": req.Seq, "userId": userId, "emoji": req.Emoji}
+    changed := false
+    if action == "add" {
+        if msg.DeletedAt != nil { respond(c, http.StatusConflict, "message recalled", nil); return }
+        _, err := coll.InsertOne(c, model.MessageReaction{ConversationId: req.ConversationId, Seq: req.Seq, UserId: userId, Emoji: req.Emoji, CreatedAt: time.Now()})
+        if err != nil && !mongo.IsDuplicateKeyError(err) { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        changed = err == nil
+    } else {
+        res, err := coll.DeleteOne(c, key)
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        changed = res.DeletedCount > 0
+    }
+    count, err := coll.CountDocuments(c, bson.M{"conversationId": req.ConversationId, "seq": req.Seq, "emoji": req.Emoji})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    change := &model.ReactionChange{Emoji: req.Emoji, Action: action, Count: count}
+    if !changed {
+        respond(c, http.StatusOK, "success", gin.H{"changed": false, "reaction": change})
+        return
+    }
+    ev, err := recordMessageEvent(c, convType, &model.MessageEvent{ConversationId: req.ConversationId, Type: "reaction", Seq: req.Seq, OperatorId: userId, Reaction: change})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"changed": true, "reaction": change, "event": ev})
+}
+
+// attachReactions 为同一会话的一批消息聚合表情回应（按首次回应时间排序）并标记当前用户是否已回应。
+func attachReactions(ctx context.Context, userId, conversationId string, list []model.Message) error {
+    if len(list) == 0 { return nil }
+    seqs := make([]int64, 0, len(list))
+    for _, m := range list { seqs = append(seqs, m.Seq) }
+    cur, err := repository.DB().Collection("message_reactions").Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"conversationId": conversationId, "seq": bson.M{"$in": seqs}}}},
+        {{Key: "$group", Value: bson.M{
+            "_id":   bson.M{"seq": "$seq", "emoji": "$emoji"},
+            "count": bson.M{"$sum": 1},
+            "mine":  bson.M{"$max": bson.M{"$eq": bson.A{"$userId", userId}}},
+            "first": bson.M{"$min": "$createdAt"},
+        }}},
+        {{Key: "$sort", Value: bson.D{{Key: "first", Value: 1}}}},
+    })
+    if err != nil { return err }
+    var rows []struct {
+        Id struct {
+            Seq   int64  `bson:"seq"`
+            Emoji string `bson:"emoji"`
+        } `bson:"_id"`
+        Count int64 `bson:"count"`
+        Mine  bool  `bson:"mine"`
+    }
+    if err := cur.All(ctx, &rows); err != nil { return err }
+    bySeq := make(map[int64][]model.ReactionCount)
+    for _, r := range rows {
+        bySeq[r.Id.Seq] = append(bySeq[r.Id.Seq], model.ReactionCount{Emoji: r.Id.Emoji, Count: r.Count, ReactedByMe: r.Mine})
+    }
+    for i := range list { list[i].Reactions = bySeq[list[i].Seq] }
+    return nil
+}
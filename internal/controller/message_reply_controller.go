@@ -0,0 +1,72 @@
+package controller
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// ListReplies 列出回复某条消息的全部消息（按 seq 升序，after 为游标），并返回被回复的原消息。
+func ListReplies(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    var seq, after int64
+    fmt.Sscan(c.Query("seq"), &seq)
+    fmt.Sscan(c.DefaultQuery("after", "0"), &after)
+    if convId == "" || seq <= 0 { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    var limit int64 = 50
+    fmt.Sscan(c.DefaultQuery("limit", "50"), &limit)
+    if limit <= 0 || limit > 100 { limit = 50 }
+    if _, ok := requireConversationAccess(c, userId, "", convId, false); !ok { return }
+
+    var root model.Message
+    err := repository.DB().Collection("messages").FindOne(c, bson.M{"conversationId": convId, "seq": seq, "hiddenFor": bson.M{"$ne": userId}}).Decode(&root)
+    if err == mongo.ErrNoDocuments { respond(c, http.StatusNotFound, "message not found", nil); return }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    base := bson.M{"conversationId": convId, "replyToSeq": seq, "hiddenFor": bson.M{"$ne": userId}}
+    list, more, err := pageMessages(c, base, bson.M{"$gt": after}, true, limit)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if list == nil { list = []model.Message{} }
+    // 原消息与回复一起填充引用预览与表情回应
+    all := append([]model.Message{root}, list...)
+    if err := attachQuotes(c, convId, all); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if err := attachReactions(c, userId, convId, all); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"root": all[0], "replies": all[1:], "has_more": more})
+}
+
+// quoteOf 生成被回复消息的引用预览；已撤回的消息不暴露原内容。
+func quoteOf(m model.Message) *model.MessageQuote {
+    return &model.MessageQuote{
+        Seq:           m.Seq,
+        SenderUserId:  m.SenderUserId,
+        CharacterInfo: m.CharacterInfo,
+        Preview:       summarize(m),
+        Recalled:      m.DeletedAt != nil,
+    }
+}
+
+// attachQuotes 为同一会话的一批消息批量填充引用预览，被引用消息不存在时保留 reply_to_seq 但不附带预览。
+func attachQuotes(ctx context.Context, conversationId string, list []model.Message) error {
+    seqs := make([]int64, 0)
+    for _, m := range list {
+        if m.ReplyToSeq > 0 { seqs = append(seqs, m.ReplyToSeq) }
+    }
+    if len(seqs) == 0 { return nil }
+    cur, err := repository.DB().Collection("messages").Find(ctx, bson.M{"conversationId": conversationId, "seq": bson.M{"$in": seqs}})
+    if err != nil { return err }
+    var targets []model.Message
+    if err := cur.All(ctx, &targets); err != nil { return err }
+    bySeq := make(map[int64]model.Message, len(targets))
+    for _, t := range targets { bySeq[t.Seq] = t }
+    for i := range list {
+        if t, ok := bySeq[list[i].ReplyToSeq]; ok { list[i].Quote = quoteOf(t) }
+    }
+    return nil
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+    "roleplay/internal/search"
+)
+
+// searchMaxRounds 单次请求最多扫描的批次数，避免低命中率查询扫描过多数据。
+const searchMaxRounds = 5
+
+// SearchMessages 全文检索消息：指定 conversation_id 时仅检索该会话，否则检索我所在的全部会话；
+// 支持按发送者、消息类型、元素类型与时间范围（RFC3339）过滤，按 last_id 游标倒序分页。
+func SearchMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    q := strings.TrimSpace(c.Query("q"))
+    if q == "" { respond(c, http.StatusBadRequest, "missing q", nil); return }
+    tokens := search.QueryTokens(q)
+    if len(tokens) == 0 { respond(c, http.StatusBadRequest, "query has no searchable text", nil); return }
+    var limit int64 = 20
+    fmt.Sscan(c.DefaultQuery("limit", "20"), &limit)
+    if limit <= 0 || limit > 50 { limit = 20 }
+
+    filter := bson.M{
+        "searchTokens": bson.M{"$all": tokens},
+        "deletedAt":    nil,
+        "hiddenFor":    bson.M{"$ne": userId},
+    }
+    if convId := c.Query("conversation_id"); convId != "" {
+        if _, ok := requireConversationAccess(c, userId, "", convId, false); !ok { return }
+        filter["conversationId"] = convId
+    } else {
+        ids, err := myConversationIds(c, userId)
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        filter["conversationId"] = bson.M{"$in": ids}
+    }
+    if sender := c.Query("sender"); sender != "" { filter["senderUserId"] = sender }
+    if t := c.Query("message_type"); t != "" { filter["messageType"] = t }
+    if t := c.Query("element_type"); t != "" { filter["element.type"] = t }
+    createdAt := bson.M{}
+    for param, op := range map[string]string{"from": "$gte", "to": "$lte"} {
+        if v := c.Query(param); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil { respond(c, http.StatusBadRequest, "invalid "+param, nil); return }
+            createdAt[op] = t
+        }
+    }
+    if len(createdAt) > 0 { filter["createdAt"] = createdAt }
+
+    var cursor primitive.ObjectID
+    if lastId := c.Query("last_id"); lastId != "" {
+        oid, err := primitive.ObjectIDFromHex(lastId)
+        if err != nil { respond(c, http.StatusBadRequest, "invalid last_id", nil); return }
+        cursor = oid
+    }
+
+    // 二元组组合可能误命中，按原文子串二次过滤，分批扫描直至凑满一页
+    results := make([]model.Message, 0, limit)
+    exhausted := false
+    for round := 0; round < searchMaxRounds && int64(len(results)) < limit; round++ {
+        if !cursor.IsZero() { filter["_id"] = bson.M{"$lt": cursor} }
+        batch := limit * 2
+        cur, err := repository.DB().Collection("messages").Find(c, filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(batch))
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        var list []model.Message
+        if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        for _, m := range list {
+            cursor = m.ID
+            if search.Match(element.Text(m.Element.Type, m.Element.Data), q) {
+                results = append(results, m)
+                if int64(len(results)) == limit { break }
+            }
+        }
+        // 本批不足且已全部扫描：没有更多结果
+        if int64(len(list)) < batch && (len(list) == 0 || cursor == list[len(list)-1].ID) {
+            exhausted = true
+            break
+        }
+    }
+    next := ""
+    if !exhausted && !cursor.IsZero() { next = cursor.Hex() }
+    respond(c, http.StatusOK, "success", gin.H{"messages": results, "next_cursor": next})
+}
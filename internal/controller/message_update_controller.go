@@ -0,0 +1,164 @@
+package controller
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/config"
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+    "roleplay/internal/search"
+)
+
+type messageRefReq struct {
+    ConversationId string `json:"conversation_id"`
+    Seq            int64  `json:"seq"`
+}
+
+// RecallMessage 撤回消息：仅发送者可在时限内撤回，消息保留为墓碑以维持 seq 连续。
+func RecallMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    msg, ok := loadOwnMessage(c, userId, req.ConversationId, req.Seq)
+    if !ok { return }
+    if time.Since(msg.CreatedAt) > config.RecallWindow() {
+        respond(c, http.StatusForbidden, "recall window expired", nil)
+        return
+    }
+    now := time.Now()
+    tombstone := model.MessageElement{Type: "recalled", Data: map[string]interface{}{}}
+    res, err := repository.DB().Collection("messages").UpdateOne(c,
+        bson.M{"_id": msg.ID, "deletedAt": nil},
+        bson.M{"$set": bson.M{"element": tombstone, "deletedAt": now, "updatedAt": now}, "$unset": bson.M{"editHistory": "", "searchTokens": ""}},
+    )
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if res.ModifiedCount == 0 { respond(c, http.StatusConflict, "message already recalled", nil); return }
+    msg.Element, msg.DeletedAt = tombstone, &now
+    refreshLastMessage(c, msg)
+    // 撤回后不再提示未读 @，通知预览改为撤回提示
+    _, _ = repository.DB().Collection("mentions").DeleteMany(c, bson.M{"conversationId": msg.ConversationId, "seq": msg.Seq})
+    refreshNotificationPreviews(c, msg)
+    ev, err := recordMessageEvent(c, msg.ConversationType, &model.MessageEvent{ConversationId: msg.ConversationId, Type: "recall", Seq: msg.Seq, OperatorId: userId})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", ev)
+}
+
+// EditMessage 编辑消息：仅发送者可编辑，旧内容保存在 editHistory 中。
+func EditMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req struct {
+        messageRefReq
+        Element map[string]interface{} `json:"element"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 || len(req.Element) == 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    msg, ok := loadOwnMessage(c, userId, req.ConversationId, req.Seq)
+    if !ok { return }
+    if msg.DeletedAt != nil { respond(c, http.StatusConflict, "message recalled", nil); return }
+    elemType, _ := req.Element["type"].(string)
+    if elemType != msg.Element.Type { respond(c, http.StatusBadRequest, "element type cannot be changed", nil); return }
+    if element.Internal(elemType) { respond(c, http.StatusBadRequest, "element cannot be edited", nil); return }
+    if err := element.Validate(elemType, req.Element); err != nil { respondError(c, err); return }
+    elem := model.MessageElement{Type: elemType, Data: req.Element, Mentions: msg.Element.Mentions, MentionAll: msg.Element.MentionAll}
+    now := time.Now()
+    // 以 updatedAt 做乐观锁，避免并发编辑丢失历史
+    res, err := repository.DB().Collection("messages").UpdateOne(c,
+        bson.M{"_id": msg.ID, "deletedAt": nil, "updatedAt": msg.UpdatedAt},
+        bson.M{
+            "$set":  bson.M{"element": elem, "searchTokens": search.Tokens(element.Text(elemType, req.Element)), "searchVersion": search.Version, "updatedAt": now},
+            "$push": bson.M{"editHistory": model.MessageEdit{Element: msg.Element, EditedAt: now}},
+        },
+    )
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if res.ModifiedCount == 0 { respond(c, http.StatusConflict, "message changed, retry", nil); return }
+    msg.Element = elem
+    refreshLastMessage(c, msg)
+    refreshNotificationPreviews(c, msg)
+    ev, err := recordMessageEvent(c, msg.ConversationType, &model.MessageEvent{ConversationId: msg.ConversationId, Type: "edit", Seq: msg.Seq, OperatorId: userId, Element: &elem})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", ev)
+}
+
+// DeleteMessageForMe 仅对自己删除消息，其他成员不受影响。
+func DeleteMessageForMe(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, "", req.ConversationId, false); !ok { return }
+    var msg model.Message
+    err := repository.DB().Collection("messages").FindOneAndUpdate(c,
+        bson.M{"conversationId": req.ConversationId, "seq": req.Seq},
+        bson.M{"$addToSet": bson.M{"hiddenFor": userId}},
+    ).Decode(&msg)
+    if err != nil { respond(c, http.StatusNotFound, "message not found", nil); return }
+    ev, err := recordMessageEvent(c, msg.ConversationType, &model.MessageEvent{ConversationId: msg.ConversationId, Type: "delete", Seq: msg.Seq, OperatorId: userId, VisibleTo: userId})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", ev)
+}
+
+// loadOwnMessage 读取当前用户在其所属会话中发送的消息，失败时已写回响应。
+func loadOwnMessage(c *gin.Context, userId, conversationId string, seq int64) (model.Message, bool) {
+    var msg model.Message
+    if _, ok := requireConversationAccess(c, userId, "", conversationId, false); !ok { return msg, false }
+    if err := repository.DB().Collection("messages").FindOne(c, bson.M{"conversationId": conversationId, "seq": seq}).Decode(&msg); err != nil {
+        respond(c, http.StatusNotFound, "message not found", nil)
+        return msg, false
+    }
+    if msg.SenderUserId != userId {
+        respond(c, http.StatusForbidden, "forbidden", nil)
+        return msg, false
+    }
+    return msg, true
+}
+
+// refreshLastMessage 被修改的消息恰为会话最新消息时，同步更新会话摘要并推送 conversation.update，
+// 会话排序不变（不修改 updatedAt）。
+func refreshLastMessage(ctx context.Context, msg model.Message) {
+    var conv model.Conversation
+    err := repository.DB().Collection("conversations").FindOneAndUpdate(ctx,
+        bson.M{"conversationId": msg.ConversationId, "lastSeq": msg.Seq},
+        bson.M{"$set": bson.M{"lastMessage": summarize(msg)}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&conv)
+    if err != nil { return }
+    publishToConversation(ctx, msg.ConversationType, msg.ConversationId, realtime.Event{Type: "conversation.update", Data: conversationUpdate{
+        ConversationId: conv.ConversationId, ConversationType: msg.ConversationType, LastSeq: conv.LastSeq, LastMessage: conv.LastMessage, UpdatedAt: conv.UpdatedAt,
+    }})
+}
+
+// recordMessageEvent 分配会话内 eventSeq 并持久化变更事件，随后实时推送；
+// VisibleTo 非空的事件只推送给该用户。
+func recordMessageEvent(ctx context.Context, conversationType string, ev *model.MessageEvent) (*model.MessageEvent, error) {
+    eventSeq, err := nextSeq(ctx, ev.ConversationId+"#events")
+    if err != nil { return nil, err }
+    ev.EventSeq = eventSeq
+    ev.CreatedAt = time.Now()
+    if _, err := repository.DB().Collection("message_events").InsertOne(ctx, ev); err != nil {
+        zap.L().Error("insert message event", zap.String("conversationId", ev.ConversationId), zap.Error(err))
+        return nil, err
+    }
+    rt := realtime.Event{Type: "message." + ev.Type, Data: ev}
+    if ev.VisibleTo != "" {
+        realtime.Publish([]string{ev.VisibleTo}, rt)
+    } else {
+        publishToConversation(ctx, conversationType, ev.ConversationId, rt)
+    }
+    return ev, nil
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+// maxMentions 单条消息最多 @ 的用户数。
+const maxMentions = 50
+
+// resolveMentions 校验 @ 对象并返回需要通知的用户（不含发送者）：仅群聊与房间支持 @，
+// 被 @ 用户须为当前成员；@全体成员 仅限群主与管理员。
+func resolveMentions(ctx context.Context, userId, convType, convId string, members, mentions []string, all bool) ([]string, []string, error) {
+    if len(mentions) == 0 && !all { return nil, nil, nil }
+    if convType != "group" && convType != "room" { return nil, nil, badRequestError("mentions are only supported in groups and rooms") }
+    if len(mentions) > maxMentions { return nil, nil, badRequestError(fmt.Sprintf("at most %d mentions per message", maxMentions)) }
+    if all {
+        if convType != "group" { return nil, nil, badRequestError("mention all is only supported in groups") }
+        role, err := groupRole(ctx, convId, userId)
+        if err != nil { return nil, nil, err }
+        if role != "owner" && role != "admin" { return nil, nil, errForbidden }
+    }
+    // 去重并保持顺序；成员校验以发送时解析出的成员列表为准
+    uniq := make([]string, 0, len(mentions))
+    for _, id := range mentions {
+        if id == "" || contains(uniq, id) { continue }
+        if !contains(members, id) { return nil, nil, badRequestError("mentioned user is not a member: " + id) }
+        uniq = append(uniq, id)
+    }
+    targets := uniq
+    if all { targets = members }
+    notify := make([]string, 0, len(targets))
+    for _, id := range targets {
+        if id != userId { notify = append(notify, id) }
+    }
+    return uniq, notify, nil
+}
+
+// recordMentions 为被 @ 用户写入未读提及索引与通知，并实时推送 notification.new。
+func recordMentions(ctx context.Context, msg model.Message, notify []string) {
+    if len(notify) == 0 { return }
+    mentions := make([]interface{}, 0, len(notify))
+    notes := make([]model.Notification, 0, len(notify))
+    preview := summarize(msg)
+    for _, uid := range notify {
+        all := msg.Element.MentionAll && !contains(msg.Element.Mentions, uid)
+        mentions = append(mentions, model.Mention{UserId: uid, ConversationId: msg.ConversationId, Seq: msg.Seq, SenderUserId: msg.SenderUserId, All: all, CreatedAt: msg.CreatedAt})
+        notes = append(notes, model.Notification{
+            ID: primitive.NewObjectID(), UserId: uid, Type: "mention",
+            ConversationId: msg.ConversationId, ConversationType: msg.ConversationType, Seq: msg.Seq,
+            SenderUserId: msg.SenderUserId, Preview: preview, CreatedAt: msg.CreatedAt,
+        })
+    }
+    db := repository.DB()
+    _, _ = db.Collection("mentions").InsertMany(ctx, mentions, options.InsertMany().SetOrdered(false))
+    docs := make([]interface{}, 0, len(notes))
+    for _, n := range notes { docs = append(docs, n) }
+    if _, err := db.Collection("notifications").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil { return }
+    for _, n := range notes {
+        realtime.Publish([]string{n.UserId}, realtime.Event{Type: "notification.new", Data: n})
+    }
+}
+
+// refreshNotificationPreviews 消息被撤回或编辑后同步更新相关通知的预览，撤回的内容不再能从通知中读到。
+func refreshNotificationPreviews(ctx context.Context, msg model.Message) {
+    _, err := repository.DB().Collection("notifications").UpdateMany(ctx,
+        bson.M{"conversationId": msg.ConversationId, "seq": msg.Seq},
+        bson.M{"$set": bson.M{"preview": summarize(msg)}},
+    )
+    if err != nil { zap.L().Error("refresh notification previews", zap.String("conversationId", msg.ConversationId), zap.Error(err)) }
+}
+
+// unreadMentionCounts 批量统计用户在各会话中未读的 @提及数。
+func unreadMentionCounts(ctx context.Context, userId string, convIds []string) (map[string]int64, error) {
+    out := make(map[string]int64, len(convIds))
+    if len(convIds) == 0 { return out, nil }
+    cur, err := repository.DB().Collection("mentions").Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"userId": userId, "conversationId": bson.M{"$in": convIds}}}},
+        {{Key: "$group", Value: bson.M{"_id": "$conversationId", "count": bson.M{"$sum": 1}}}},
+    })
+    if err != nil { return nil, err }
+    var rows []struct {
+        Id    string `bson:"_id"`
+        Count int64  `bson:"count"`
+    }
+    if err := cur.All(ctx, &rows); err != nil { return nil, err }
+    for _, r := range rows { out[r.Id] = r.Count }
+    return out, nil
+}
+
+// ListUnreadMentions 列出会话中未读的 @我 消息（按 seq 升序），客户端据此逐条跳转。
+func ListUnreadMentions(c *gin.Context) {
+    userId := c.GetString("userId")
+    convId := c.Query("conversation_id")
+    if convId == "" { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    if _, ok := requireConversationAccess(c, userId, "", convId, false); !ok { return }
+    states, err := userConversationStates(c, userId, []string{convId})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    filter := bson.M{"userId": userId, "conversationId": convId, "seq": bson.M{"$gt": states[convId].ReadSeq}}
+    cur, err := repository.DB().Collection("mentions").Find(c, filter, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(200))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    list := make([]model.Mention, 0)
+    if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"conversation_id": convId, "read_seq": states[convId].ReadSeq, "mentions": list})
+}
+
+// ListNotifications 通知流，按 last_id 游标倒序分页；unread_only=1 时只返回未读。
+func ListNotifications(c *gin.Context) {
+    userId := c.GetString("userId")
+    var limit int64 = 20
+    fmt.Sscan(c.DefaultQuery("limit", "20"), &limit)
+    if limit <= 0 || limit > 100 { limit = 20 }
+    filter := bson.M{"userId": userId}
+    if c.Query("unread_only") == "1" || c.Query("unread_only") == "true" { filter["readAt"] = nil }
+    if lastId := c.Query("last_id"); lastId != "" {
+        oid, err := primitive.ObjectIDFromHex(lastId)
+        if err != nil { respond(c, http.StatusBadRequest, "invalid last_id", nil); return }
+        filter["_id"] = bson.M{"$lt": oid}
+    }
+    db := repository.DB()
+    cur, err := db.Collection("notifications").Find(c, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    list := make([]model.Notification, 0)
+    if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    unread, err := db.Collection("notifications").CountDocuments(c, bson.M{"userId": userId, "readAt": nil})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    next := ""
+    if int64(len(list)) == limit { next = list[len(list)-1].ID.Hex() }
+    respond(c, http.StatusOK, "success", gin.H{"notifications": list, "unread_count": unread, "next_cursor": next})
+}
+
+// MarkNotificationsRead 标记通知已读：传 ids 标记指定通知，all=true 标记全部。
+func MarkNotificationsRead(c *gin.Context) {
+    userId := c.GetString("userId")
+    var body struct {
+        Ids []string `json:"ids"`
+        All bool     `json:"all"`
+    }
+    if err := c.ShouldBindJSON(&body); err != nil || (!body.All && len(body.Ids) == 0) {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    filter := bson.M{"userId": userId, "readAt": nil}
+    if !body.All {
+        oids := make([]primitive.ObjectID, 0, len(body.Ids))
+        for _, id := range body.Ids {
+            oid, err := primitive.ObjectIDFromHex(id)
+            if err != nil { respond(c, http.StatusBadRequest, "invalid id", nil); return }
+            oids = append(oids, oid)
+        }
+        filter["_id"] = bson.M{"$in": oids}
+    }
+    res, err := repository.DB().Collection("notifications").UpdateMany(c, filter, bson.M{"$set": bson.M{"readAt": time.Now()}})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"updated": res.ModifiedCount})
+}
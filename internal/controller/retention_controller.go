@@ -0,0 +1,123 @@
+package controller
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// StarMessage 收藏消息：被收藏的消息不会因保留期被清理。
+func StarMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if _, ok := requireConversationAccess(c, userId, "", req.ConversationId, false); !ok { return }
+    n, err := repository.DB().Collection("messages").CountDocuments(c, bson.M{"conversationId": req.ConversationId, "seq": req.Seq, "hiddenFor": bson.M{"$ne": userId}})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if n == 0 { respond(c, http.StatusNotFound, "message not found", nil); return }
+    _, err = repository.DB().Collection("message_stars").InsertOne(c, model.MessageStar{UserId: userId, ConversationId: req.ConversationId, Seq: req.Seq, CreatedAt: time.Now()})
+    if err != nil && !mongo.IsDuplicateKeyError(err) { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
+
+// UnstarMessage 取消收藏。
+func UnstarMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req messageRefReq
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" || req.Seq <= 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    _, err := repository.DB().Collection("message_stars").DeleteOne(c, bson.M{"userId": userId, "conversationId": req.ConversationId, "seq": req.Seq})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
+
+// ListStarredMessages 我的收藏，按收藏时间倒序、last_id 游标分页，附带消息内容（已被清理的消息不含 message）。
+func ListStarredMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    var limit int64 = 20
+    fmt.Sscan(c.DefaultQuery("limit", "20"), &limit)
+    if limit <= 0 || limit > 100 { limit = 20 }
+    filter := bson.M{"userId": userId}
+    if convId := c.Query("conversation_id"); convId != "" { filter["conversationId"] = convId }
+    if lastId := c.Query("last_id"); lastId != "" {
+        oid, err := primitive.ObjectIDFromHex(lastId)
+        if err != nil { respond(c, http.StatusBadRequest, "invalid last_id", nil); return }
+        filter["_id"] = bson.M{"$lt": oid}
+    }
+    db := repository.DB()
+    cur, err := db.Collection("message_stars").Find(c, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    var stars []model.MessageStar
+    if err := cur.All(c, &stars); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    items := make([]gin.H, 0, len(stars))
+    if len(stars) > 0 {
+        or := make([]bson.M, 0, len(stars))
+        for _, s := range stars { or = append(or, bson.M{"conversationId": s.ConversationId, "seq": s.Seq}) }
+        cur, err := db.Collection("messages").Find(c, bson.M{"$or": or})
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        var msgs []model.Message
+        if err := cur.All(c, &msgs); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        byKey := make(map[string]model.Message, len(msgs))
+        for _, m := range msgs { byKey[fmt.Sprintf("%s:%d", m.ConversationId, m.Seq)] = m }
+        for _, s := range stars {
+            item := gin.H{"id": s.ID, "conversation_id": s.ConversationId, "seq": s.Seq, "starred_at": s.CreatedAt}
+            if m, ok := byKey[fmt.Sprintf("%s:%d", s.ConversationId, s.Seq)]; ok { item["message"] = m }
+            items = append(items, item)
+        }
+    }
+    next := ""
+    if int64(len(stars)) == limit { next = stars[len(stars)-1].ID.Hex() }
+    respond(c, http.StatusOK, "success", gin.H{"starred": items, "next_cursor": next})
+}
+
+// SetLegalHold 管理员对会话设置法律保全，保全期间消息不受保留期清理。
+func SetLegalHold(c *gin.Context) {
+    var body struct {
+        ConversationId string `json:"conversation_id"`
+        Reason         string `json:"reason"`
+    }
+    if err := c.ShouldBindJSON(&body); err != nil || body.ConversationId == "" || strings.TrimSpace(body.Reason) == "" {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    hold := model.LegalHold{ConversationId: body.ConversationId, Reason: strings.TrimSpace(body.Reason), CreatedBy: c.GetString("userId"), CreatedAt: time.Now()}
+    err := repository.DB().Collection("legal_holds").FindOneAndUpdate(c,
+        bson.M{"conversationId": body.ConversationId},
+        bson.M{"$setOnInsert": hold},
+        options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+    ).Decode(&hold)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", hold)
+}
+
+// ReleaseLegalHold 解除会话的法律保全。
+func ReleaseLegalHold(c *gin.Context) {
+    res, err := repository.DB().Collection("legal_holds").DeleteOne(c, bson.M{"conversationId": c.Param("conversation_id")})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if res.DeletedCount == 0 { respond(c, http.StatusNotFound, "legal hold not found", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
+
+// ListLegalHolds 列出全部法律保全。
+func ListLegalHolds(c *gin.Context) {
+    cur, err := repository.DB().Collection("legal_holds").Find(c, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    list := make([]model.LegalHold, 0)
+    if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"legal_holds": list})
+}
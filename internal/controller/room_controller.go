@@ -48,30 +48,11 @@ func GetRoomMessages(c *gin.Context) {
     GetMessageHistory(c)
 }
 
-// SendRoomMessage 复用统一发送接口，conversation_id 使用 room_id。
+// SendRoomMessage 复用统一发送流程，conversation_id 使用 room_id。
 func SendRoomMessage(c *gin.Context) {
-    rid := c.Param("id")
-    var body map[string]interface{}
-    if err := c.ShouldBindJSON(&body); err != nil { respond(c, http.StatusBadRequest, "invalid request", nil); return }
-    body["conversation_type"] = "room"
-    body["conversation_id"] = rid
-    // Reuse SendMessage by binding again
-    c.Set("_override_body", body)
-    // Quick rebuild
-    type req struct {
-        ConversationType string                 `json:"conversation_type"`
-        ConversationId   string                 `json:"conversation_id"`
-        MessageType      string                 `json:"message_type"`
-        Element          map[string]interface{} `json:"element"`
-        CharacterId      string                 `json:"character_id"`
-    }
-    var r req
-    r.ConversationType = "room"
-    r.ConversationId = rid
-    if v, ok := body["message_type"].(string); ok { r.MessageType = v }
-    if v, ok := body["element"].(map[string]interface{}); ok { r.Element = v }
-    if v, ok := body["character_id"].(string); ok { r.CharacterId = v }
-    // Delegate
-    SendMessage(c)
+    var req sendMsgReq
+    if err := c.ShouldBindJSON(&req); err != nil { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    req.ConversationType = "room"
+    req.ConversationId = c.Param("id")
+    respondSend(c, req)
 }
-
@@ -0,0 +1,165 @@
+package controller
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/config"
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+    "roleplay/internal/scheduler"
+)
+
+// ScheduleMessage 创建定时消息：创建时即校验元素与发言权限，到点后由后台任务投递。
+func ScheduleMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req struct {
+        sendMsgReq
+        SendAt time.Time `json:"send_at"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil || req.ConversationId == "" {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if !validSendAt(c, req.SendAt) { return }
+    elemType, _ := req.Element["type"].(string)
+    if err := element.Validate(elemType, req.Element); err != nil { respondError(c, err); return }
+    if element.Internal(elemType) { respondError(c, &element.ValidationError{Type: elemType, Reason: "cannot be sent directly"}); return }
+    if req.MessageType == "system" { respondError(c, badRequestError("system messages cannot be sent directly")); return }
+    convType, err := authorizeConversation(c, userId, req.ConversationType, req.ConversationId, true)
+    if err != nil { respondError(c, err); return }
+    coll := repository.DB().Collection("scheduled_messages")
+    pending, err := coll.CountDocuments(c, bson.M{"senderUserId": userId, "status": "pending"})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if pending >= int64(config.C.Message.ScheduleMaxPending) { respond(c, http.StatusConflict, "too many pending scheduled messages", nil); return }
+
+    now := time.Now()
+    sm := model.ScheduledMessage{
+        SenderUserId:     userId,
+        ConversationType: convType,
+        ConversationId:   req.ConversationId,
+        MessageType:      req.MessageType,
+        Element:          req.Element,
+        CharacterId:      req.CharacterId,
+        ReplyToSeq:       req.ReplyToSeq,
+        Mentions:         req.Mentions,
+        MentionAll:       req.MentionAll,
+        SendAt:           req.SendAt,
+        Status:           "pending",
+        CreatedAt:        now,
+        UpdatedAt:        now,
+    }
+    res, err := coll.InsertOne(c, sm)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    sm.ID = res.InsertedID.(primitive.ObjectID)
+    respond(c, http.StatusOK, "success", sm)
+}
+
+// ListScheduledMessages 列出我的定时消息，默认只看待发送的，按发送时间升序。
+func ListScheduledMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    filter := bson.M{"senderUserId": userId, "status": c.DefaultQuery("status", "pending")}
+    if convId := c.Query("conversation_id"); convId != "" { filter["conversationId"] = convId }
+    var limit int64 = 50
+    fmt.Sscan(c.DefaultQuery("limit", "50"), &limit)
+    if limit <= 0 || limit > 100 { limit = 50 }
+    cur, err := repository.DB().Collection("scheduled_messages").Find(c, filter, options.Find().SetSort(bson.D{{Key: "sendAt", Value: 1}}).SetLimit(limit))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    list := make([]model.ScheduledMessage, 0)
+    if err := cur.All(c, &list); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"scheduled_messages": list})
+}
+
+// EditScheduledMessage 修改待发送的定时消息内容或发送时间；已开始投递的不可修改。
+func EditScheduledMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req struct {
+        Id      string                 `json:"id"`
+        Element map[string]interface{} `json:"element"`
+        SendAt  *time.Time             `json:"send_at"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil || (len(req.Element) == 0 && req.SendAt == nil) {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    oid, err := primitive.ObjectIDFromHex(req.Id)
+    if err != nil { respond(c, http.StatusBadRequest, "invalid id", nil); return }
+    set := bson.M{"updatedAt": time.Now()}
+    if req.SendAt != nil {
+        if !validSendAt(c, *req.SendAt) { return }
+        set["sendAt"] = *req.SendAt
+    }
+    if len(req.Element) > 0 {
+        elemType, _ := req.Element["type"].(string)
+        if err := element.Validate(elemType, req.Element); err != nil { respondError(c, err); return }
+        if element.Internal(elemType) { respondError(c, &element.ValidationError{Type: elemType, Reason: "cannot be sent directly"}); return }
+        set["element"] = req.Element
+    }
+    var sm model.ScheduledMessage
+    err = repository.DB().Collection("scheduled_messages").FindOneAndUpdate(c,
+        bson.M{"_id": oid, "senderUserId": userId, "status": "pending"},
+        bson.M{"$set": set},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&sm)
+    if err == mongo.ErrNoDocuments { respond(c, http.StatusNotFound, "scheduled message not found or already sending", nil); return }
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", sm)
+}
+
+// CancelScheduledMessage 取消待发送的定时消息。
+func CancelScheduledMessage(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req struct {
+        Id string `json:"id"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    oid, err := primitive.ObjectIDFromHex(req.Id)
+    if err != nil { respond(c, http.StatusBadRequest, "invalid id", nil); return }
+    res, err := repository.DB().Collection("scheduled_messages").UpdateOne(c,
+        bson.M{"_id": oid, "senderUserId": userId, "status": "pending"},
+        bson.M{"$set": bson.M{"status": "canceled", "updatedAt": time.Now()}},
+    )
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if res.MatchedCount == 0 { respond(c, http.StatusNotFound, "scheduled message not found or already sending", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
+
+// DeliverScheduled 供后台任务调用：经正常发送流水线投递定时消息。
+// 以定时消息ID作为 client_msg_id，重复投递（如租约过期后重试）只会落库一次。
+func DeliverScheduled(ctx context.Context, sm model.ScheduledMessage) (int64, error) {
+    msg, _, err := deliverMessage(ctx, sm.SenderUserId, sendMsgReq{
+        ConversationType: sm.ConversationType,
+        ConversationId:   sm.ConversationId,
+        MessageType:      sm.MessageType,
+        Element:          sm.Element,
+        CharacterId:      sm.CharacterId,
+        ClientMsgId:      "scheduled:" + sm.ID.Hex(),
+        ReplyToSeq:       sm.ReplyToSeq,
+        Mentions:         sm.Mentions,
+        MentionAll:       sm.MentionAll,
+    })
+    var verr *element.ValidationError
+    var berr badRequestError
+    if errors.Is(err, errForbidden) || errors.Is(err, errInvalidConversation) || errors.As(err, &verr) || errors.As(err, &berr) {
+        return 0, fmt.Errorf("%w: %v", scheduler.ErrPermanent, err)
+    }
+    return msg.Seq, err
+}
+
+// validSendAt 发送时间须晚于当前且不超过可提前设置的上限，失败时已写回响应。
+func validSendAt(c *gin.Context, t time.Time) bool {
+    now := time.Now()
+    if t.IsZero() || !t.After(now) { respond(c, http.StatusBadRequest, "send_at must be in the future", nil); return false }
+    if t.After(now.Add(config.ScheduleMaxAhead())) { respond(c, http.StatusBadRequest, "send_at too far in the future", nil); return false }
+    return true
+}
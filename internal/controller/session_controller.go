@@ -0,0 +1,58 @@
+package controller
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+
+    "roleplay/internal/auth"
+)
+
+// ListSessions 列出当前用户已登录的设备（会话），标记当前请求所在的会话。
+func ListSessions(c *gin.Context) {
+    current := c.GetString("sessionId")
+    list, err := auth.ListSessions(c, c.GetString("userId"))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    items := make([]gin.H, 0, len(list))
+    for _, s := range list {
+        items = append(items, gin.H{
+            "session_id":     s.SessionId,
+            "device_id":      s.DeviceId,
+            "platform":       s.Platform,
+            "ip":             s.IP,
+            "user_agent":     s.UserAgent,
+            "created_at":     s.CreatedAt,
+            "last_active_at": s.LastActiveAt,
+            "current":        s.SessionId == current,
+        })
+    }
+    respond(c, http.StatusOK, "success", gin.H{"sessions": items})
+}
+
+// RevokeSession 下线指定设备：吊销其会话与刷新令牌，其访问令牌随之失效。
+func RevokeSession(c *gin.Context) {
+    var req struct {
+        SessionId string `json:"session_id"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil || req.SessionId == "" { respond(c, http.StatusBadRequest, "invalid request", nil); return }
+    ok, err := auth.RevokeSession(c, c.GetString("userId"), req.SessionId)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if !ok { respond(c, http.StatusNotFound, "session not found", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
+
+// RevokeOtherSessions 下线除当前设备外的全部设备。
+func RevokeOtherSessions(c *gin.Context) {
+    n, err := auth.RevokeOtherSessions(c, c.GetString("userId"), c.GetString("sessionId"))
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", gin.H{"revoked": n})
+}
+
+// Logout 退出当前设备：吊销当前会话及其刷新令牌，并将当前访问令牌加入黑名单直至过期。
+func Logout(c *gin.Context) {
+    claims, _ := c.MustGet("tokenClaims").(*auth.Claims)
+    if claims == nil { respond(c, http.StatusUnauthorized, "invalid token", nil); return }
+    if _, err := auth.RevokeSession(c, claims.UserId, claims.Family); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    if err := auth.DenyToken(c, claims); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    respond(c, http.StatusOK, "success", nil)
+}
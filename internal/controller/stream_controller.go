@@ -0,0 +1,194 @@
+package controller
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/auth"
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+const (
+    sseReplayLimit   = 500
+    sseHeartbeat     = 25 * time.Second
+    sseWriteDeadline = 10 * time.Second
+)
+
+// StreamEvents 以 Server-Sent Events 推送当前用户的新消息与会话变更（WebSocket 不可用时的降级方案）。
+// 断线重连时携带 Last-Event-ID（或 last_event_id 参数），服务端补发其后的消息。
+func StreamEvents(c *gin.Context) {
+    userId := c.GetString("userId")
+    claims, _ := c.MustGet("tokenClaims").(*auth.Claims)
+    lastEventId := c.GetHeader("Last-Event-ID")
+    if lastEventId == "" {
+        lastEventId = c.Query("last_event_id")
+    }
+
+    // 先订阅再补发，保证补发期间产生的新消息不会丢失
+    sub := realtime.Subscribe(userId, c.GetString("sessionId"))
+    defer sub.Close()
+
+    rc := http.NewResponseController(c.Writer)
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("Connection", "keep-alive")
+    c.Header("X-Accel-Buffering", "no")
+    c.Status(http.StatusOK)
+
+    write := func(ev realtime.Event) bool {
+        // 服务器全局 WriteTimeout 不适用于长连接，逐次续期写超时
+        _ = rc.SetWriteDeadline(time.Now().Add(sseWriteDeadline))
+        if err := writeSSE(c.Writer, ev); err != nil {
+            return false
+        }
+        return rc.Flush() == nil
+    }
+
+    // sent 记录补发阶段各会话已推送的最大 seq，用于丢弃订阅缓冲中的重复消息
+    sent := map[string]int64{}
+    if lastEventId != "" {
+        backlog, complete, err := replayMessages(c, userId, lastEventId)
+        if err != nil {
+            zap.L().Warn("sse replay", zap.String("userId", userId), zap.Error(err))
+        }
+        for _, m := range backlog {
+            if !write(realtime.Event{ID: streamEventId(m.ConversationId, m.Seq), Type: "message.new", Data: m}) {
+                return
+            }
+            if m.Seq > sent[m.ConversationId] {
+                sent[m.ConversationId] = m.Seq
+            }
+        }
+        if !complete {
+            // 积压过多或游标无效：提示客户端通过历史接口自行补齐
+            if !write(realtime.Event{Type: "resync", Data: gin.H{"last_event_id": lastEventId}}) {
+                return
+            }
+        }
+    }
+    if !write(realtime.Event{Type: "ready", Data: gin.H{"user_id": userId}}) {
+        return
+    }
+
+    ticker := time.NewTicker(sseHeartbeat)
+    defer ticker.Stop()
+    recheck := time.NewTicker(streamAuthRecheck)
+    defer recheck.Stop()
+    for {
+        select {
+        case <-c.Request.Context().Done():
+            return
+        case ev, ok := <-sub.C():
+            if !ok {
+                return
+            }
+            if m, isMsg := ev.Data.(model.Message); isMsg && m.Seq <= sent[m.ConversationId] {
+                continue
+            }
+            if !write(ev) {
+                return
+            }
+        case <-ticker.C:
+            _ = rc.SetWriteDeadline(time.Now().Add(sseWriteDeadline))
+            if _, err := c.Writer.WriteString(": ping\n\n"); err != nil || rc.Flush() != nil {
+                return
+            }
+        case <-recheck.C:
+            if !streamAuthorized(c.Request.Context(), claims, c.ClientIP()) {
+                // 会话已在其它实例被吊销或令牌已被拉黑：通知客户端后断开
+                write(realtime.Event{Type: "session.revoked"})
+                return
+            }
+        }
+    }
+}
+
+// replayMessages 根据事件ID定位断线时刻，返回该会话 seq 之后及其它会话中排在锚点消息之后的消息；
+// 其它会话以 (createdAt, _id) 作为游标，同一毫秒内的消息既不重复也不遗漏。
+// complete 为 false 表示游标无法识别或积压超过上限，客户端需自行补齐。
+func replayMessages(c *gin.Context, userId, lastEventId string) (list []model.Message, complete bool, err error) {
+    convId, seq, ok := parseStreamEventId(lastEventId)
+    if !ok {
+        return nil, false, nil
+    }
+    col := repository.DB().Collection("messages")
+    var anchor model.Message
+    if err := col.FindOne(c, bson.M{"conversationId": convId, "seq": seq}).Decode(&anchor); err != nil {
+        return nil, false, nil
+    }
+    convIds, err := myConversationIds(c, userId)
+    if err != nil {
+        return nil, false, err
+    }
+    others := make([]string, 0, len(convIds))
+    member := false
+    for _, id := range convIds {
+        if id == convId {
+            member = true
+            continue
+        }
+        others = append(others, id)
+    }
+    or := []bson.M{
+        {"conversationId": bson.M{"$in": others}, "createdAt": bson.M{"$gt": anchor.CreatedAt}},
+        {"conversationId": bson.M{"$in": others}, "createdAt": anchor.CreatedAt, "_id": bson.M{"$gt": anchor.ID}},
+    }
+    if member {
+        or = append(or, bson.M{"conversationId": convId, "seq": bson.M{"$gt": seq}})
+    }
+    opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(sseReplayLimit + 1)
+    // 与历史、同步接口一致：不重放用户已对自己删除的消息
+    cur, err := col.Find(c, bson.M{"$or": or, "hiddenFor": bson.M{"$ne": userId}}, opts)
+    if err != nil {
+        return nil, false, err
+    }
+    if err := cur.All(c, &list); err != nil {
+        return nil, false, err
+    }
+    if len(list) > sseReplayLimit {
+        return list[:sseReplayLimit], false, nil
+    }
+    return list, true, nil
+}
+
+// streamEventId 生成事件ID，与会话内 seq 一一对应。
+func streamEventId(conversationId string, seq int64) string {
+    return conversationId + ":" + strconv.FormatInt(seq, 10)
+}
+
+func parseStreamEventId(id string) (string, int64, bool) {
+    i := strings.LastIndex(id, ":")
+    if i <= 0 {
+        return "", 0, false
+    }
+    seq, err := strconv.ParseInt(id[i+1:], 10, 64)
+    if err != nil || seq <= 0 {
+        return "", 0, false
+    }
+    return id[:i], seq, true
+}
+
+func writeSSE(w gin.ResponseWriter, ev realtime.Event) error {
+    data, err := json.Marshal(ev.Data)
+    if err != nil {
+        return err
+    }
+    var b strings.Builder
+    if ev.ID != "" {
+        fmt.Fprintf(&b, "id: %s\n", ev.ID)
+    }
+    fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", ev.Type, data)
+    _, err = w.WriteString(b.String())
+    return err
+}
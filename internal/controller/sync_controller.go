@@ -0,0 +1,174 @@
+package controller
+
+import (
+    "context"
+    "errors"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+const (
+    syncMaxConversations = 100
+    syncDefaultPerConv   = 50
+    syncMaxPerConv       = 200
+    syncMaxEvents        = 200
+)
+
+type syncReq struct {
+    // Conversations 会话ID -> 客户端已知的最大 seq
+    Conversations map[string]int64 `json:"conversations"`
+    // EventSeqs 会话ID -> 客户端已处理的最大 eventSeq（可选，缺省视为 0）
+    EventSeqs map[string]int64 `json:"event_seqs"`
+    // SettingsSeqs 会话ID -> 客户端已知的个人设置版本（可选，缺省视为 0）
+    SettingsSeqs map[string]int64 `json:"settings_seqs"`
+    // Limit 每个会话最多返回的消息数
+    Limit int64 `json:"limit"`
+}
+
+// syncItem 单个有变化的会话的增量数据。
+type syncItem struct {
+    ConversationId   string                `json:"conversation_id"`
+    ConversationType string                `json:"conversation_type"`
+    LastSeq          int64                 `json:"last_seq"`
+    LastMessage      string                `json:"last_message"`
+    EventSeq         int64                 `json:"event_seq"`
+    ReadSeq          int64                 `json:"read_seq"`
+    PinnedMessages   []model.PinnedMessage `json:"pinned_messages"`
+    Settings         conversationSettings  `json:"settings"`
+    Messages         []model.Message       `json:"messages"`
+    Events           []model.MessageEvent  `json:"events"`
+    // GapTooLarge 缺口超过单会话上限：messages 仅含最新的一段，更早部分需通过历史接口向前翻页
+    GapTooLarge     bool `json:"gap_too_large"`
+    EventsTruncated bool `json:"events_truncated"`
+}
+
+// SyncMessages 断线重连后的多会话增量同步：一次返回各会话缺失的消息以及已知消息上的撤回、编辑等变更。
+// 未变化的会话不出现在结果中；无权访问的会话列在 denied 中。
+func SyncMessages(c *gin.Context) {
+    userId := c.GetString("userId")
+    var req syncReq
+    if err := c.ShouldBindJSON(&req); err != nil || len(req.Conversations) == 0 {
+        respond(c, http.StatusBadRequest, "invalid request", nil)
+        return
+    }
+    if len(req.Conversations) > syncMaxConversations {
+        respond(c, http.StatusBadRequest, "too many conversations", nil)
+        return
+    }
+    perConv := req.Limit
+    if perConv <= 0 { perConv = syncDefaultPerConv }
+    if perConv > syncMaxPerConv { perConv = syncMaxPerConv }
+
+    convIds := make([]string, 0, len(req.Conversations))
+    for id := range req.Conversations { convIds = append(convIds, id) }
+    db := repository.DB()
+    cur, err := db.Collection("conversations").Find(c, bson.M{"conversationId": bson.M{"$in": convIds}})
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    var convs []model.Conversation
+    if err := cur.All(c, &convs); err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    eventSeqs, err := currentEventSeqs(c, convIds)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+    states, err := userConversationStates(c, userId, convIds)
+    if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+
+    items := make([]syncItem, 0)
+    denied := make([]string, 0)
+    found := make(map[string]bool, len(convs))
+    for _, cv := range convs {
+        found[cv.ConversationId] = true
+        knownSeq := req.Conversations[cv.ConversationId]
+        knownEvent := req.EventSeqs[cv.ConversationId]
+        eventSeq := eventSeqs[cv.ConversationId]
+        settingsChanged := states[cv.ConversationId].SettingsSeq > req.SettingsSeqs[cv.ConversationId]
+        if cv.LastSeq <= knownSeq && eventSeq <= knownEvent && !settingsChanged { continue }
+        if _, err := authorizeConversation(c, userId, cv.ConversationType, cv.ConversationId, false); err != nil {
+            if errors.Is(err, errForbidden) || errors.Is(err, errInvalidConversation) {
+                denied = append(denied, cv.ConversationId)
+                continue
+            }
+            respondError(c, err)
+            return
+        }
+        item, err := syncConversation(c, userId, cv, knownSeq, knownEvent, eventSeq, perConv)
+        if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
+        item.ReadSeq = states[cv.ConversationId].ReadSeq
+        item.Settings = settingsOf(states[cv.ConversationId])
+        items = append(items, item)
+    }
+    for _, id := range convIds {
+        if !found[id] { denied = append(denied, id) }
+    }
+    respond(c, http.StatusOK, "success", gin.H{"conversations": items, "denied": denied})
+}
+
+// syncConversation 取单个会话 knownSeq 之后的消息与 knownEvent 之后涉及已知消息的变更事件。
+func syncConversation(ctx context.Context, userId string, cv model.Conversation, knownSeq, knownEvent, eventSeq, limit int64) (syncItem, error) {
+    item := syncItem{
+        ConversationId:   cv.ConversationId,
+        ConversationType: cv.ConversationType,
+        LastSeq:          cv.LastSeq,
+        LastMessage:      cv.LastMessage,
+        EventSeq:         eventSeq,
+        PinnedMessages:   append([]model.PinnedMessage{}, cv.PinnedMessages...),
+        Messages:         []model.Message{},
+        Events:           []model.MessageEvent{},
+    }
+    base := bson.M{"conversationId": cv.ConversationId, "hiddenFor": bson.M{"$ne": userId}}
+    if cv.LastSeq > knownSeq {
+        if cv.LastSeq-knownSeq > limit {
+            // 缺口过大时只返回最新一段，客户端据此展示并按需向前补齐
+            list, _, err := pageMessages(ctx, base, bson.M{"$gt": knownSeq}, false, limit)
+            if err != nil { return item, err }
+            item.Messages = list
+            item.GapTooLarge = true
+        } else {
+            list, _, err := pageMessages(ctx, base, bson.M{"$gt": knownSeq}, true, limit)
+            if err != nil { return item, err }
+            item.Messages = list
+        }
+    }
+    if err := attachQuotes(ctx, cv.ConversationId, item.Messages); err != nil { return item, err }
+    if err := attachReactions(ctx, userId, cv.ConversationId, item.Messages); err != nil { return item, err }
+    // 新返回的消息已是最新状态，只需同步客户端已持有的消息（seq <= knownSeq）上的变更
+    if knownSeq > 0 {
+        filter := bson.M{
+            "conversationId": cv.ConversationId,
+            "eventSeq":       bson.M{"$gt": knownEvent},
+            "seq":            bson.M{"$lte": knownSeq},
+            "$or":            []bson.M{{"visibleTo": bson.M{"$exists": false}}, {"visibleTo": userId}},
+        }
+        opts := options.Find().SetSort(bson.D{{Key: "eventSeq", Value: 1}}).SetLimit(syncMaxEvents + 1)
+        cur, err := repository.DB().Collection("message_events").Find(ctx, filter, opts)
+        if err != nil { return item, err }
+        if err := cur.All(ctx, &item.Events); err != nil { return item, err }
+        if len(item.Events) > syncMaxEvents {
+            // 事件未取完：event_seq 回退到本次最后一条，客户端下次从这里继续
+            item.Events = item.Events[:syncMaxEvents]
+            item.EventsTruncated = true
+            item.EventSeq = item.Events[len(item.Events)-1].EventSeq
+        }
+    }
+    return item, nil
+}
+
+// currentEventSeqs 批量读取各会话当前的变更事件序号（counters 中 "<conversationId>#events"）。
+func currentEventSeqs(ctx context.Context, convIds []string) (map[string]int64, error) {
+    keys := make([]string, 0, len(convIds))
+    for _, id := range convIds { keys = append(keys, id+"#events") }
+    cur, err := repository.DB().Collection("counters").Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+    if err != nil { return nil, err }
+    var list []struct {
+        Id  string `bson:"_id"`
+        Seq int64  `bson:"seq"`
+    }
+    if err := cur.All(ctx, &list); err != nil { return nil, err }
+    out := make(map[string]int64, len(list))
+    for _, r := range list { out[r.Id[:len(r.Id)-len("#events")]] = r.Seq }
+    return out, nil
+}
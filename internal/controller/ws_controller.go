@@ -0,0 +1,127 @@
+package controller
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "go.uber.org/zap"
+
+    "roleplay/internal/auth"
+    "roleplay/internal/realtime"
+)
+
+const (
+    wsWriteWait      = 10 * time.Second
+    wsPongWait       = 60 * time.Second
+    wsPingPeriod     = wsPongWait * 9 / 10
+    wsMaxMessageSize = 4096
+    // streamAuthRecheck 长连接期间复查会话与令牌黑名单的间隔，覆盖其它实例上发生的吊销
+    streamAuthRecheck = 30 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+    ReadBufferSize:  1024,
+    WriteBufferSize: 4096,
+    // 移动端与第三方前端均会跨域接入，鉴权依赖令牌而非 Origin
+    CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeWS 建立 WebSocket 长连接，向当前用户推送其所在会话的新消息。
+// 浏览器无法自定义握手头，令牌可通过 Authorization 头或 token 查询参数携带。
+func ServeWS(c *gin.Context) {
+    token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+    if token == "" {
+        token = c.Query("token")
+    }
+    if token == "" {
+        respond(c, http.StatusUnauthorized, "missing token", nil)
+        return
+    }
+    claims, err := auth.ParseTokenOfType(token, auth.TokenTypeAccess)
+    if err != nil {
+        respond(c, http.StatusUnauthorized, "invalid token", nil)
+        return
+    }
+    if denied, err := auth.TokenDenied(c, claims); err != nil || denied {
+        respond(c, http.StatusUnauthorized, "invalid token", nil)
+        return
+    }
+    if active, err := auth.CheckSession(c, claims.Family, c.ClientIP()); err != nil || !active {
+        respond(c, http.StatusUnauthorized, "invalid token", nil)
+        return
+    }
+    conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+    if err != nil {
+        // Upgrade 失败时已写回错误响应
+        zap.L().Warn("websocket upgrade", zap.Error(err))
+        return
+    }
+    sub := realtime.Subscribe(claims.UserId, claims.Family)
+    go wsWritePump(conn, sub, claims, c.ClientIP())
+    wsReadPump(conn, sub)
+}
+
+// wsReadPump 仅用于维持心跳与感知断线，客户端上行消息一律忽略。
+func wsReadPump(conn *websocket.Conn, sub *realtime.Subscription) {
+    defer sub.Close()
+    conn.SetReadLimit(wsMaxMessageSize)
+    _ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+    conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(wsPongWait)) })
+    for {
+        if _, _, err := conn.ReadMessage(); err != nil {
+            return
+        }
+    }
+}
+
+// streamAuthorized 复查长连接所属令牌是否仍然有效：未被拉黑且会话未吊销。查询出错时保守地断开。
+func streamAuthorized(ctx context.Context, claims *auth.Claims, ip string) bool {
+    if denied, err := auth.TokenDenied(ctx, claims); err != nil || denied {
+        return false
+    }
+    active, err := auth.CheckSession(ctx, claims.Family, ip)
+    return err == nil && active
+}
+
+// wsWritePump 独占连接的写端：转发订阅事件、定时发送 ping 并复查会话有效性。
+func wsWritePump(conn *websocket.Conn, sub *realtime.Subscription, claims *auth.Claims, ip string) {
+    ticker := time.NewTicker(wsPingPeriod)
+    recheck := time.NewTicker(streamAuthRecheck)
+    defer func() {
+        ticker.Stop()
+        recheck.Stop()
+        _ = conn.Close()
+    }()
+    for {
+        select {
+        case ev, ok := <-sub.C():
+            _ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+            if !ok {
+                // 订阅被终止（停机或消费过慢），通知客户端稍后重连
+                _ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "subscription closed"))
+                return
+            }
+            if err := conn.WriteJSON(ev); err != nil {
+                return
+            }
+        case <-ticker.C:
+            _ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+            if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+                return
+            }
+        case <-recheck.C:
+            ctx, cancel := context.WithTimeout(context.Background(), wsWriteWait)
+            ok := streamAuthorized(ctx, claims, ip)
+            cancel()
+            if !ok {
+                _ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+                _ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"))
+                return
+            }
+        }
+    }
+}
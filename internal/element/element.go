@@ -0,0 +1,166 @@
+package element
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+    "sync"
+    "unicode/utf8"
+)
+
+// Spec 描述一种消息元素：发送前的数据校验、会话列表中的摘要文案与可供检索的正文。
+// Internal 为 true 的类型只能由服务端流程（如合并转发）生成，客户端直接发送或编辑时拒绝。
+type Spec struct {
+    Validate func(data map[string]interface{}) error
+    Summary  func(data map[string]interface{}) string
+    Text     func(data map[string]interface{}) string
+    Internal bool
+}
+
+// ValidationError 元素数据不合法，错误信息可直接返回给客户端。
+type ValidationError struct {
+    Type   string
+    Reason string
+}
+
+func (e *ValidationError) Error() string {
+    if e.Type == "" {
+        return "invalid element: " + e.Reason
+    }
+    return fmt.Sprintf("invalid %s element: %s", e.Type, e.Reason)
+}
+
+var (
+    mu       sync.RWMutex
+    registry = map[string]Spec{}
+)
+
+// Register 注册元素类型，重复注册会覆盖旧定义。
+func Register(elemType string, spec Spec) {
+    mu.Lock()
+    defer mu.Unlock()
+    registry[elemType] = spec
+}
+
+// Types 返回已注册的全部元素类型（按字母序）。
+func Types() []string {
+    mu.RLock()
+    defer mu.RUnlock()
+    out := make([]string, 0, len(registry))
+    for t := range registry {
+        out = append(out, t)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// Validate 按类型校验元素数据；未注册的类型一律拒绝。
+func Validate(elemType string, data map[string]interface{}) error {
+    if elemType == "" {
+        return &ValidationError{Reason: "type is required"}
+    }
+    mu.RLock()
+    spec, ok := registry[elemType]
+    mu.RUnlock()
+    if !ok {
+        return &ValidationError{Type: elemType, Reason: "unsupported element type"}
+    }
+    if spec.Validate == nil {
+        return nil
+    }
+    if err := spec.Validate(data); err != nil {
+        return &ValidationError{Type: elemType, Reason: err.Error()}
+    }
+    return nil
+}
+
+// Internal 判断元素类型是否仅限服务端生成。
+func Internal(elemType string) bool {
+    mu.RLock()
+    spec, ok := registry[elemType]
+    mu.RUnlock()
+    return ok && spec.Internal
+}
+
+// Summary 生成元素摘要，用于 Conversation.LastMessage 等预览场景。
+func Summary(elemType string, data map[string]interface{}) string {
+    mu.RLock()
+    spec, ok := registry[elemType]
+    mu.RUnlock()
+    if !ok || spec.Summary == nil {
+        return "[" + elemType + "]"
+    }
+    return spec.Summary(data)
+}
+
+// Text 提取元素中可供全文检索的文本；无文本的类型返回空串。
+func Text(elemType string, data map[string]interface{}) string {
+    mu.RLock()
+    spec, ok := registry[elemType]
+    mu.RUnlock()
+    if !ok || spec.Text == nil {
+        return ""
+    }
+    return spec.Text(data)
+}
+
+// Truncate 按字符截断摘要文本，超长时追加省略号。
+func Truncate(s string, n int) string {
+    s = strings.TrimSpace(s)
+    if utf8.RuneCountInString(s) <= n {
+        return s
+    }
+    r := []rune(s)
+    return string(r[:n]) + "…"
+}
+
+// String 读取字符串字段：required 时不可为空，maxLen>0 时限制字符数。
+func String(data map[string]interface{}, key string, required bool, maxLen int) (string, error) {
+    raw, ok := data[key]
+    if !ok || raw == nil {
+        if required {
+            return "", fmt.Errorf("%s is required", key)
+        }
+        return "", nil
+    }
+    s, ok := raw.(string)
+    if !ok {
+        return "", fmt.Errorf("%s must be a string", key)
+    }
+    if required && strings.TrimSpace(s) == "" {
+        return "", fmt.Errorf("%s is required", key)
+    }
+    if maxLen > 0 && utf8.RuneCountInString(s) > maxLen {
+        return "", fmt.Errorf("%s exceeds %d characters", key, maxLen)
+    }
+    return s, nil
+}
+
+// Number 读取数值字段（JSON 数字解码为 float64）并校验闭区间 [min, max]。
+func Number(data map[string]interface{}, key string, required bool, min, max float64) (float64, error) {
+    raw, ok := data[key]
+    if !ok || raw == nil {
+        if required {
+            return 0, fmt.Errorf("%s is required", key)
+        }
+        return 0, nil
+    }
+    var f float64
+    switch v := raw.(type) {
+    case float64:
+        f = v
+    case int:
+        f = float64(v)
+    case int32:
+        f = float64(v)
+    case int64:
+        f = float64(v)
+    default:
+        return 0, fmt.Errorf("%s must be a number", key)
+    }
+    if math.IsNaN(f) || f < min || f > max {
+        return 0, fmt.Errorf("%s out of range", key)
+    }
+    return f, nil
+}
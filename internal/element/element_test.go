@@ -0,0 +1,141 @@
+package element
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+type obj = map[string]interface{}
+
+func TestValidate(t *testing.T) {
+    cases := []struct {
+        name     string
+        elemType string
+        data     obj
+        ok       bool
+    }{
+        {"missing type", "", obj{"text": "hi"}, false},
+        {"unknown type", "video", obj{"url": "https://a/b.mp4"}, false},
+
+        {"text", "text", obj{"text": "你好"}, true},
+        {"text blank", "text", obj{"text": "  "}, false},
+        {"text missing", "text", obj{}, false},
+        {"text not string", "text", obj{"text": 42.0}, false},
+        {"text too long", "text", obj{"text": strings.Repeat("字", maxTextLen+1)}, false},
+
+        {"image https", "image", obj{"url": "https://cdn.example.com/a.png", "width": 100.0, "height": 80.0}, true},
+        {"image static", "image", obj{"url": "/static/a.png"}, true},
+        {"image bad scheme", "image", obj{"url": "javascript:alert(1)"}, false},
+        {"image width out of range", "image", obj{"url": "/static/a.png", "width": 30000.0}, false},
+
+        {"audio", "audio", obj{"url": "/static/a.mp3", "duration": 12.0}, true},
+        {"audio no duration", "audio", obj{"url": "/static/a.mp3"}, false},
+        {"audio too long", "audio", obj{"url": "/static/a.mp3", "duration": 601.0}, false},
+
+        {"sticker by id", "sticker", obj{"sticker_id": "s1"}, true},
+        {"sticker by url", "sticker", obj{"url": "https://a/s.gif"}, true},
+        {"sticker neither", "sticker", obj{}, false},
+
+        {"dice default sides", "dice", obj{"value": 6.0}, true},
+        {"dice over default sides", "dice", obj{"value": 7.0}, false},
+        {"dice custom sides", "dice", obj{"value": 20.0, "sides": 20.0}, true},
+        {"dice one side", "dice", obj{"value": 1.0, "sides": 1.0}, false},
+        {"dice int value", "dice", obj{"value": 3}, true},
+
+        {"system", "system", obj{"text": "张三 加入了群聊"}, true},
+        {"system too long", "system", obj{"text": strings.Repeat("a", 501)}, false},
+
+        {"start_block empty", "start_block", obj{}, true},
+        {"start_block title too long", "start_block", obj{"title": strings.Repeat("a", 101)}, false},
+
+        {"merged_forward", "merged_forward", obj{"items": []interface{}{obj{"element": obj{"type": "text", "text": "hi"}}}}, true},
+        {"merged_forward no items", "merged_forward", obj{"items": []interface{}{}}, false},
+        {"merged_forward bad item", "merged_forward", obj{"items": []interface{}{obj{"text": "hi"}}}, false},
+        {"merged_forward too many", "merged_forward", obj{"items": forwardItems(MaxForwardItems + 1)}, false},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            err := Validate(tc.elemType, tc.data)
+            if tc.ok && err != nil {
+                t.Fatalf("Validate: %v", err)
+            }
+            if !tc.ok {
+                var verr *ValidationError
+                if !errors.As(err, &verr) {
+                    t.Fatalf("Validate = %v, want *ValidationError", err)
+                }
+            }
+        })
+    }
+}
+
+func forwardItems(n int) []interface{} {
+    items := make([]interface{}, n)
+    for i := range items {
+        items[i] = obj{"element": obj{"type": "text", "text": "hi"}}
+    }
+    return items
+}
+
+func TestInternal(t *testing.T) {
+    for elemType, want := range map[string]bool{
+        "text": false, "image": false, "start_block": false,
+        "system": true, "merged_forward": true,
+        "unknown": false,
+    } {
+        if got := Internal(elemType); got != want {
+            t.Errorf("Internal(%q) = %v, want %v", elemType, got, want)
+        }
+    }
+}
+
+func TestSummaryAndText(t *testing.T) {
+    if got := Summary("text", obj{"text": strings.Repeat("字", summaryLength+5)}); got != strings.Repeat("字", summaryLength)+"…" {
+        t.Errorf("text summary = %q", got)
+    }
+    if got := Summary("audio", obj{"duration": 12.0}); got != `[语音] 12"` {
+        t.Errorf("audio summary = %q", got)
+    }
+    if got := Summary("video", nil); got != "[video]" {
+        t.Errorf("unknown summary = %q", got)
+    }
+    forward := obj{"title": "群聊记录", "items": []interface{}{
+        obj{"element": obj{"type": "text", "text": "第一条"}},
+        obj{"element": obj{"type": "image", "url": "/static/a.png"}},
+        obj{"element": obj{"type": "start_block", "title": "开场", "text": "很久以前"}},
+    }}
+    if got, want := Text("merged_forward", forward), "群聊记录\n第一条\n开场\n很久以前"; got != want {
+        t.Errorf("merged_forward text = %q, want %q", got, want)
+    }
+    if got := Text("image", obj{"url": "/static/a.png"}); got != "" {
+        t.Errorf("image text = %q, want empty", got)
+    }
+}
+
+func TestRegister(t *testing.T) {
+    Register("test_poll", Spec{Validate: func(d map[string]interface{}) error {
+        _, err := String(d, "question", true, 10)
+        return err
+    }})
+    t.Cleanup(func() {
+        mu.Lock()
+        delete(registry, "test_poll")
+        mu.Unlock()
+    })
+    found := false
+    for _, typ := range Types() {
+        if typ == "test_poll" { found = true }
+    }
+    if !found {
+        t.Fatal("registered type missing from Types()")
+    }
+    if err := Validate("test_poll", obj{"question": "吃什么"}); err != nil {
+        t.Errorf("Validate: %v", err)
+    }
+    err := Validate("test_poll", obj{})
+    var verr *ValidationError
+    if !errors.As(err, &verr) || verr.Type != "test_poll" {
+        t.Errorf("Validate = %v, want ValidationError for test_poll", err)
+    }
+}
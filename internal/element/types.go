@@ -0,0 +1,181 @@
+package element
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+)
+
+const (
+    maxTextLen    = 5000
+    summaryLength = 50
+    // MaxForwardItems 合并转发单个聊天记录最多包含的消息数
+    MaxForwardItems = 100
+)
+
+func init() {
+    Register("text", Spec{
+        Validate: func(d map[string]interface{}) error {
+            _, err := String(d, "text", true, maxTextLen)
+            return err
+        },
+        Summary: func(d map[string]interface{}) string {
+            s, _ := d["text"].(string)
+            return Truncate(s, summaryLength)
+        },
+        Text: textField("text"),
+    })
+    Register("image", Spec{
+        Validate: func(d map[string]interface{}) error {
+            if err := mediaURL(d, "url"); err != nil { return err }
+            if _, err := Number(d, "width", false, 0, 20000); err != nil { return err }
+            _, err := Number(d, "height", false, 0, 20000)
+            return err
+        },
+        Summary: func(map[string]interface{}) string { return "[图片]" },
+    })
+    Register("audio", Spec{
+        Validate: func(d map[string]interface{}) error {
+            if err := mediaURL(d, "url"); err != nil { return err }
+            _, err := Number(d, "duration", true, 1, 600)
+            return err
+        },
+        Summary: func(d map[string]interface{}) string {
+            if sec, ok := d["duration"].(float64); ok {
+                return fmt.Sprintf("[语音] %d\"", int(sec))
+            }
+            return "[语音]"
+        },
+    })
+    Register("sticker", Spec{
+        Validate: func(d map[string]interface{}) error {
+            id, err := String(d, "sticker_id", false, 64)
+            if err != nil { return err }
+            if id == "" {
+                return mediaURL(d, "url")
+            }
+            return nil
+        },
+        Summary: func(d map[string]interface{}) string {
+            if name, _ := d["name"].(string); name != "" {
+                return "[" + Truncate(name, 10) + "]"
+            }
+            return "[表情]"
+        },
+        Text: textField("name"),
+    })
+    Register("dice", Spec{
+        Validate: func(d map[string]interface{}) error {
+            sides, err := Number(d, "sides", false, 2, 100)
+            if err != nil { return err }
+            if sides == 0 { sides = 6 }
+            _, err = Number(d, "value", true, 1, sides)
+            return err
+        },
+        Summary: func(d map[string]interface{}) string {
+            if v, ok := d["value"].(float64); ok {
+                return fmt.Sprintf("[骰子] %d", int(v))
+            }
+            return "[骰子]"
+        },
+    })
+    // system 系统提示：仅由服务端流程生成，防止成员伪造系统通知
+    Register("system", Spec{
+        Internal: true,
+        Validate: func(d map[string]interface{}) error {
+            _, err := String(d, "text", true, 500)
+            return err
+        },
+        Summary: func(d map[string]interface{}) string {
+            s, _ := d["text"].(string)
+            return Truncate(s, summaryLength)
+        },
+        Text: textField("text"),
+    })
+    // start_block 演绎开场块：标记一段剧情的开始，可附带标题与开场白
+    Register("start_block", Spec{
+        Validate: func(d map[string]interface{}) error {
+            if _, err := String(d, "title", false, 100); err != nil { return err }
+            _, err := String(d, "text", false, maxTextLen)
+            return err
+        },
+        Summary: func(d map[string]interface{}) string {
+            if title, _ := d["title"].(string); title != "" {
+                return "[开场] " + Truncate(title, summaryLength)
+            }
+            return "[开场]"
+        },
+        Text: textField("title", "text"),
+    })
+    // merged_forward 合并转发的聊天记录：items 内嵌原消息的发送者、角色信息与元素，可展开查看
+    Register("merged_forward", Spec{
+        Internal: true,
+        Validate: func(d map[string]interface{}) error {
+            if _, err := String(d, "title", false, 100); err != nil { return err }
+            items := list(d["items"])
+            if len(items) == 0 { return fmt.Errorf("items is required") }
+            if len(items) > MaxForwardItems { return fmt.Errorf("items exceeds %d", MaxForwardItems) }
+            for _, it := range items {
+                if _, ok := itemElement(it); !ok { return fmt.Errorf("invalid item") }
+            }
+            return nil
+        },
+        Summary: func(d map[string]interface{}) string {
+            if title, _ := d["title"].(string); title != "" {
+                return "[聊天记录] " + Truncate(title, summaryLength)
+            }
+            return "[聊天记录]"
+        },
+        Text: func(d map[string]interface{}) string {
+            parts := []string{}
+            if title, _ := d["title"].(string); title != "" { parts = append(parts, title) }
+            for _, it := range list(d["items"]) {
+                if el, ok := itemElement(it); ok {
+                    t, _ := el["type"].(string)
+                    if s := Text(t, el); s != "" { parts = append(parts, s) }
+                }
+            }
+            return strings.Join(parts, "\n")
+        },
+    })
+}
+
+// list 将数组字段转为 []interface{}（兼容 JSON 解码与 bson 解码出的不同切片类型）。
+func list(v interface{}) []interface{} {
+    rv := reflect.ValueOf(v)
+    if !rv.IsValid() || rv.Kind() != reflect.Slice { return nil }
+    out := make([]interface{}, rv.Len())
+    for i := range out { out[i] = rv.Index(i).Interface() }
+    return out
+}
+
+// itemElement 取合并转发条目中的 element 字段。
+func itemElement(item interface{}) (map[string]interface{}, bool) {
+    it, ok := item.(map[string]interface{})
+    if !ok { return nil, false }
+    el, ok := it["element"].(map[string]interface{})
+    return el, ok
+}
+
+// textField 拼接若干字符串字段作为检索正文。
+func textField(keys ...string) func(map[string]interface{}) string {
+    return func(d map[string]interface{}) string {
+        parts := make([]string, 0, len(keys))
+        for _, k := range keys {
+            if s, _ := d[k].(string); s != "" {
+                parts = append(parts, s)
+            }
+        }
+        return strings.Join(parts, "\n")
+    }
+}
+
+// mediaURL 媒体地址须为 http(s) 链接或本服务 /static 下的相对路径。
+func mediaURL(d map[string]interface{}, key string) error {
+    u, err := String(d, key, true, 2048)
+    if err != nil { return err }
+    if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "/static/") {
+        return nil
+    }
+    return fmt.Errorf("%s must be an http(s) or /static/ url", key)
+}
@@ -28,6 +28,31 @@ func EnsureAllIndexes(ctx context.Context) error {
         {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
     }); err != nil { return err }
 
+    // sms_send_limits 验证码发送频率计数（按手机号/IP 各一条，TTL）
+    if err := createIndexes(ctx, db.Collection("sms_send_limits"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+    }); err != nil { return err }
+
+    // refresh_tokens 刷新令牌登记（TTL）
+    if err := createIndexes(ctx, db.Collection("refresh_tokens"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "family", Value: 1}}},
+        {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+    }); err != nil { return err }
+
+    // sessions 登录会话（TTL，随刷新令牌旋转顺延）
+    if err := createIndexes(ctx, db.Collection("sessions"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "sessionId", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastActiveAt", Value: -1}}},
+        {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+    }); err != nil { return err }
+
+    // token_denylist 已登出的访问令牌（TTL，令牌过期即清理）
+    if err := createIndexes(ctx, db.Collection("token_denylist"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+    }); err != nil { return err }
+
     // friend_requests 好友申请集合
     if err := createIndexes(ctx, db.Collection("friend_requests"), []mongo.IndexModel{
         {Keys: bson.D{{Key: "recipientId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
@@ -62,11 +87,71 @@ func EnsureAllIndexes(ctx context.Context) error {
     if err := createIndexes(ctx, db.Collection("conversations"), []mongo.IndexModel{
         {Keys: bson.D{{Key: "conversationId", Value: 1}}, Options: options.Index().SetUnique(true)},
         {Keys: bson.D{{Key: "participants", Value: 1}}},
-        {Keys: bson.D{{Key: "updatedAt", Value: -1}}},
+        {Keys: bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}},
+    }); err != nil { return err }
+    // user_conversations 用户会话状态（已读游标）
+    if err := createIndexes(ctx, db.Collection("user_conversations"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "conversationId", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "readSeq", Value: 1}}},
     }); err != nil { return err }
     if err := createIndexes(ctx, db.Collection("messages"), []mongo.IndexModel{
         {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
         {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}}},
+        // 保留期清理：按会话类型扫描过期消息
+        {Keys: bson.D{{Key: "conversationType", Value: 1}, {Key: "createdAt", Value: 1}}},
+        // 客户端消息ID去重（仅对携带 clientMsgId 的消息生效）
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "senderUserId", Value: 1}, {Key: "clientMsgId", Value: 1}},
+            Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"clientMsgId": bson.M{"$exists": true}})},
+        // 回复串：按被回复消息列出全部回复
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "replyToSeq", Value: 1}, {Key: "seq", Value: 1}},
+            Options: options.Index().SetPartialFilterExpression(bson.M{"replyToSeq": bson.M{"$gt": 0}})},
+        // 全文检索：n-gram 索引词（多键索引）
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "searchTokens", Value: 1}}},
+        // 索引词重建：启动时按 searchVersion 找出旧规则生成的消息
+        {Keys: bson.D{{Key: "searchVersion", Value: 1}, {Key: "_id", Value: 1}}},
+    }); err != nil { return err }
+    // client_msg_reservations 发送中的 client_msg_id 占用（分配 seq 前写入，过期自动清理）
+    if err := createIndexes(ctx, db.Collection("client_msg_reservations"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+    }); err != nil { return err }
+    // message_events 消息变更事件（撤回/编辑/删除）
+    if err := createIndexes(ctx, db.Collection("message_events"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "eventSeq", Value: 1}}, Options: options.Index().SetUnique(true)},
+    }); err != nil { return err }
+    // message_reactions 表情回应（每人每表情一条）
+    if err := createIndexes(ctx, db.Collection("message_reactions"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}, {Key: "userId", Value: 1}, {Key: "emoji", Value: 1}}, Options: options.Index().SetUnique(true)},
+    }); err != nil { return err }
+    // scheduled_messages 定时消息（后台按 status+sendAt 领取，用户按发送者查看）
+    if err := createIndexes(ctx, db.Collection("scheduled_messages"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "status", Value: 1}, {Key: "sendAt", Value: 1}}},
+        {Keys: bson.D{{Key: "senderUserId", Value: 1}, {Key: "status", Value: 1}, {Key: "sendAt", Value: 1}}},
+    }); err != nil { return err }
+    // message_stars 收藏消息
+    if err := createIndexes(ctx, db.Collection("message_stars"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}},
+    }); err != nil { return err }
+    // legal_holds 法律保全（每个会话至多一条）
+    if err := createIndexes(ctx, db.Collection("legal_holds"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "conversationId", Value: 1}}, Options: options.Index().SetUnique(true)},
+    }); err != nil { return err }
+    // messages_archive 过期归档消息
+    if err := createIndexes(ctx, db.Collection("messages_archive"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}},
+        {Keys: bson.D{{Key: "archivedAt", Value: -1}}},
+    }); err != nil { return err }
+    // mentions 未读 @提及索引
+    if err := createIndexes(ctx, db.Collection("mentions"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}},
+    }); err != nil { return err }
+    // notifications 用户通知流
+    if err := createIndexes(ctx, db.Collection("notifications"), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+        {Keys: bson.D{{Key: "userId", Value: 1}, {Key: "readAt", Value: 1}}},
+        {Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}},
     }); err != nil { return err }
     // if err := createIndexes(ctx, db.Collection("counters"), []mongo.IndexModel{
     //     {Keys: bson.D{{Key: "_id", Value: 1}}, Options: options.Index().SetUnique(true)},
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+
+    "roleplay/internal/config"
+)
+
+// AdminOnly 仅允许配置中的管理员访问，需挂在 AuthMiddleware 之后。
+func AdminOnly() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if !config.IsAdmin(c.GetString("userId")) {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 403, "message": "forbidden"})
+            return
+        }
+        c.Next()
+    }
+}
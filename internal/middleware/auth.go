@@ -19,21 +19,41 @@ func AuthMiddleware() gin.HandlerFunc {
             return
         }
         token := strings.TrimPrefix(header, "Bearer ")
-        claims, err := auth.ParseToken(token)
+        claims, err := auth.ParseTokenOfType(token, auth.TokenTypeAccess)
         if err != nil {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "invalid token"})
             return
         }
-        // 即将过期则自动刷新，避免刷新风暴可加入最小间隔控制（此处简化）
+        // 已登出的访问令牌在黑名单中；会话被吊销（下线其它设备、刷新令牌重放等）后，其访问令牌同样失效
+        denied, err := auth.TokenDenied(c, claims)
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "server error"})
+            return
+        }
+        if denied {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "token revoked"})
+            return
+        }
+        active, err := auth.CheckSession(c, claims.Family, c.ClientIP())
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "server error"})
+            return
+        }
+        if !active {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "session revoked"})
+            return
+        }
+        // 即将过期则自动续发同一令牌族的访问令牌；刷新令牌只能经 /api/auth/refresh 旋转，此处不再下发
         if claims.ExpiresAt != nil {
             if time.Until(claims.ExpiresAt.Time) < 5*time.Minute && time.Until(claims.ExpiresAt.Time) > 0 {
-                if at, rt, err := auth.GenerateTokens(claims.UserId); err == nil {
+                if at, _, err := auth.GenerateAccessToken(claims.UserId, claims.Family); err == nil {
                     c.Header("New-Access-Token", at)
-                    c.Header("New-Refresh-Token", rt)
                 }
             }
         }
         c.Set("userId", claims.UserId)
+        c.Set("sessionId", claims.Family)
+        c.Set("tokenClaims", claims)
         c.Next()
     }
 }
@@ -0,0 +1,83 @@
+package migrate
+
+import (
+    "context"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.uber.org/zap"
+
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// BackfillDMParticipants 修复旧版私聊会话的参与者列表。
+// 旧版发送消息时以 $setOnInsert 仅写入首个发送者，另一方因此无权访问该私聊；
+// 这里以会话中全部消息的发送者补全参与者，仅当推断出的集合恰为两人且双方是（或曾经是）好友时才写入；
+// 对方从未发言、发送者多于两人或双方从无好友关系的会话只记录告警并跳过，需双方经 /conversation/dm 重新打开。
+func BackfillDMParticipants(ctx context.Context) error {
+    db := repository.DB()
+    cur, err := db.Collection("conversations").Find(ctx, bson.M{"conversationType": "dm", "participants.1": bson.M{"$exists": false}})
+    if err != nil { return err }
+    var convs []model.Conversation
+    if err := cur.All(ctx, &convs); err != nil { return err }
+    fixed := 0
+    for _, conv := range convs {
+        senders, err := db.Collection("messages").Distinct(ctx, "senderUserId", bson.M{"conversationId": conv.ConversationId})
+        if err != nil { return err }
+        participants := inferDMParticipants(conv.Participants, senders)
+        if len(participants) != 2 {
+            zap.L().Warn("dm conversation participants ambiguous, skipped",
+                zap.String("conversationId", conv.ConversationId), zap.Strings("inferred", participants))
+            continue
+        }
+        friends, err := everFriends(ctx, participants[0], participants[1])
+        if err != nil { return err }
+        if !friends {
+            zap.L().Warn("dm conversation participants were never friends, skipped",
+                zap.String("conversationId", conv.ConversationId), zap.Strings("inferred", participants))
+            continue
+        }
+        if _, err := db.Collection("conversations").UpdateOne(ctx, bson.M{"_id": conv.ID}, bson.M{"$set": bson.M{"participants": participants}}); err != nil {
+            return err
+        }
+        fixed++
+    }
+    if fixed > 0 { zap.L().Info("backfilled dm participants", zap.Int("conversations", fixed)) }
+    return nil
+}
+
+// inferDMParticipants 合并已有参与者与消息发送者（去重、去空，保持出现顺序）。
+func inferDMParticipants(existing []string, senders []interface{}) []string {
+    participants := make([]string, 0, len(existing)+len(senders))
+    for _, uid := range existing {
+        if uid != "" && !contains(participants, uid) { participants = append(participants, uid) }
+    }
+    for _, s := range senders {
+        uid, ok := s.(string)
+        if !ok || uid == "" || contains(participants, uid) { continue }
+        participants = append(participants, uid)
+    }
+    return participants
+}
+
+// everFriends 判断两人当前是好友，或曾有已同意的好友申请（之后可能已删除好友）。
+func everFriends(ctx context.Context, a, b string) (bool, error) {
+    db := repository.DB()
+    n, err := db.Collection("friends").CountDocuments(ctx, bson.M{"$or": []bson.M{
+        {"userA": a, "userB": b},
+        {"userA": b, "userB": a},
+    }})
+    if err != nil || n > 0 { return n > 0, err }
+    n, err = db.Collection("friend_requests").CountDocuments(ctx, bson.M{"status": "accepted", "$or": []bson.M{
+        {"requesterId": a, "recipientId": b},
+        {"requesterId": b, "recipientId": a},
+    }})
+    return n > 0, err
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s { return true }
+    }
+    return false
+}
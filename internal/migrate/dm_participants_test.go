@@ -0,0 +1,29 @@
+package migrate
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestInferDMParticipants(t *testing.T) {
+    cases := []struct {
+        name     string
+        existing []string
+        senders  []interface{}
+        want     []string
+    }{
+        {"peer spoke", []string{"u1"}, []interface{}{"u1", "u2"}, []string{"u1", "u2"}},
+        {"peer silent", []string{"u1"}, []interface{}{"u1"}, []string{"u1"}},
+        {"no existing", nil, []interface{}{"u2", "u1"}, []string{"u2", "u1"}},
+        {"too many senders", []string{"u1"}, []interface{}{"u2", "u3"}, []string{"u1", "u2", "u3"}},
+        {"skip empty and non-string", []string{"u1", ""}, []interface{}{"", nil, 42, "u2", "u2"}, []string{"u1", "u2"}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            got := inferDMParticipants(tc.existing, tc.senders)
+            if !reflect.DeepEqual(got, tc.want) {
+                t.Errorf("got %v, want %v", got, tc.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+    "context"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/element"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+    "roleplay/internal/search"
+)
+
+// searchBackfillBatch 每批补建索引词的消息数
+const searchBackfillBatch = 500
+
+// BackfillSearchTokens 为全文检索上线前的历史消息补建 searchTokens，并按当前规则重建旧版本生成的索引词，
+// 阻塞直至完成或 ctx 取消。已处理的消息记录 searchVersion，下次启动不会重复扫描；已撤回的消息不建索引。
+func BackfillSearchTokens(ctx context.Context) {
+    coll := repository.DB().Collection("messages")
+    filter := bson.M{"searchVersion": bson.M{"$ne": search.Version}, "deletedAt": nil}
+    total := 0
+    var lastId primitive.ObjectID
+    for ctx.Err() == nil {
+        if !lastId.IsZero() { filter["_id"] = bson.M{"$gt": lastId} }
+        cur, err := coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(searchBackfillBatch).SetProjection(bson.M{"element": 1}))
+        if err != nil { logBackfillError(ctx, err); return }
+        var list []model.Message
+        if err := cur.All(ctx, &list); err != nil { logBackfillError(ctx, err); return }
+        if len(list) == 0 { break }
+        lastId = list[len(list)-1].ID
+        writes := make([]mongo.WriteModel, 0, len(list))
+        for _, m := range list {
+            tokens := search.Tokens(element.Text(m.Element.Type, m.Element.Data))
+            if tokens == nil { tokens = []string{} }
+            writes = append(writes, mongo.NewUpdateOneModel().
+                SetFilter(bson.M{"_id": m.ID, "searchVersion": bson.M{"$ne": search.Version}}).
+                SetUpdate(bson.M{"$set": bson.M{"searchTokens": tokens, "searchVersion": search.Version}}))
+        }
+        if _, err := coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil { logBackfillError(ctx, err); return }
+        total += len(list)
+        if len(list) < searchBackfillBatch { break }
+    }
+    if total > 0 { zap.L().Info("backfilled search tokens", zap.Int("messages", total)) }
+}
+
+func logBackfillError(ctx context.Context, err error) {
+    if ctx.Err() == nil { zap.L().Error("backfill search tokens", zap.Error(err)) }
+}
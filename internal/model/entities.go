@@ -33,6 +33,55 @@ type AuthCode struct {
     Scene     string             `bson:"scene" json:"scene"`
     CreatedAt time.Time          `bson:"createdAt" json:"created_at"`
     ExpireAt  time.Time          `bson:"expireAt" json:"expire_at"`
+    // FailedAttempts 输错次数，达到上限后验证码作废；UsedAt 验证成功即写入，验证码只能使用一次
+    FailedAttempts int        `bson:"failedAttempts" json:"failed_attempts"`
+    UsedAt         *time.Time `bson:"usedAt,omitempty" json:"used_at,omitempty"`
+}
+
+// SMSSendLimit 验证码发送频率计数，_id 为 "phone:<手机号>" 或 "ip:<IP>"，用于冷却与 24 小时窗口内的发送上限；
+// 窗口与冷却均结束后由 TTL 索引清理。
+type SMSSendLimit struct {
+    Key         string    `bson:"_id" json:"key"`
+    LastSentAt  time.Time `bson:"lastSentAt" json:"last_sent_at"`
+    WindowStart time.Time `bson:"windowStart" json:"window_start"`
+    Count       int       `bson:"count" json:"count"`
+    ExpireAt    time.Time `bson:"expireAt" json:"expire_at"`
+}
+
+// DeniedToken 已登出的访问令牌，过期前一律拒绝。
+type DeniedToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TokenId   string             `bson:"tokenId" json:"token_id"`
+    UserId    string             `bson:"userId" json:"user_id"`
+    CreatedAt time.Time          `bson:"createdAt" json:"created_at"`
+    ExpireAt  time.Time          `bson:"expireAt" json:"expire_at"`
+}
+
+// Session 登录会话（设备），SessionId 即其刷新令牌族ID。
+type Session struct {
+    ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+    SessionId    string             `bson:"sessionId" json:"session_id"`
+    UserId       string             `bson:"userId" json:"-"`
+    DeviceId     string             `bson:"deviceId,omitempty" json:"device_id,omitempty"`
+    Platform     string             `bson:"platform,omitempty" json:"platform,omitempty"`
+    IP           string             `bson:"ip" json:"ip"`
+    UserAgent    string             `bson:"userAgent,omitempty" json:"user_agent,omitempty"`
+    CreatedAt    time.Time          `bson:"createdAt" json:"created_at"`
+    LastActiveAt time.Time          `bson:"lastActiveAt" json:"last_active_at"`
+    ExpireAt     time.Time          `bson:"expireAt" json:"expire_at"`
+    RevokedAt    *time.Time         `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
+}
+
+// RefreshToken 服务端登记的刷新令牌：每个只能使用一次，同一次登录旋转出的令牌属于同一令牌族。
+type RefreshToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TokenId   string             `bson:"tokenId" json:"token_id"`
+    UserId    string             `bson:"userId" json:"user_id"`
+    Family    string             `bson:"family" json:"family"`
+    CreatedAt time.Time          `bson:"createdAt" json:"created_at"`
+    ExpireAt  time.Time          `bson:"expireAt" json:"expire_at"`
+    UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"used_at,omitempty"`
+    RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
 }
 
 type FriendRequest struct {
@@ -83,9 +132,31 @@ type Conversation struct {
     Participants     []string           `bson:"participants" json:"participants"`
     LastSeq          int64              `bson:"lastSeq" json:"last_seq"`
     LastMessage      string             `bson:"lastMessage" json:"last_message"`
+    PinnedMessages   []PinnedMessage    `bson:"pinnedMessages,omitempty" json:"pinned_messages,omitempty"`
     UpdatedAt        time.Time          `bson:"updatedAt" json:"updated_at"`
 }
 
+// PinnedMessage 会话内被置顶（钉选）的消息，对全体成员可见。
+type PinnedMessage struct {
+    Seq      int64     `bson:"seq" json:"seq"`
+    PinnedBy string    `bson:"pinnedBy" json:"pinned_by"`
+    PinnedAt time.Time `bson:"pinnedAt" json:"pinned_at"`
+}
+
+// UserConversation 用户在某会话中的个人状态（已读游标与个人设置），与 conversations 一对多。
+type UserConversation struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    ReadSeq        int64              `bson:"readSeq" json:"read_seq"`
+    Muted          bool               `bson:"muted,omitempty" json:"muted"`               // 消息免打扰
+    Pinned         bool               `bson:"pinned,omitempty" json:"pinned"`             // 会话置顶
+    Archived       bool               `bson:"archived,omitempty" json:"archived"`         // 归档
+    DisplayName    string             `bson:"displayName,omitempty" json:"display_name"` // 自定义会话名（仅自己可见）
+    SettingsSeq    int64              `bson:"settingsSeq,omitempty" json:"settings_seq"`  // 个人设置版本，每次修改递增，供多端增量同步
+    UpdatedAt      time.Time          `bson:"updatedAt" json:"updated_at"`
+}
+
 type Message struct {
     ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
     ConversationId   string              `bson:"conversationId" json:"conversation_id"`
@@ -94,17 +165,162 @@ type Message struct {
     RoomId           *primitive.ObjectID `bson:"roomId,omitempty" json:"room_id,omitempty"`
     GroupId          *primitive.ObjectID `bson:"groupId,omitempty" json:"group_id,omitempty"`
     SenderUserId     string              `bson:"senderUserId" json:"sender_user_id"`
+    ClientMsgId      string              `bson:"clientMsgId,omitempty" json:"client_msg_id,omitempty"`
     MessageType      string              `bson:"messageType" json:"message_type"`
     Element          MessageElement      `bson:"element" json:"element"`
     CharacterInfo    *CharacterInfo      `bson:"characterInfo,omitempty" json:"character_info,omitempty"`
+    ReplyToSeq       int64               `bson:"replyToSeq,omitempty" json:"reply_to_seq,omitempty"` // 回复/引用的同会话消息
+    ForwardedFrom    *ForwardInfo        `bson:"forwardedFrom,omitempty" json:"forwarded_from,omitempty"`
+    Quote            *MessageQuote       `bson:"-" json:"quote,omitempty"`                          // 查询时填充的引用预览
+    Reactions        []ReactionCount     `bson:"-" json:"reactions,omitempty"`                      // 查询时聚合的表情回应
+    EditHistory      []MessageEdit       `bson:"editHistory,omitempty" json:"edit_history,omitempty"`
+    HiddenFor        []string            `bson:"hiddenFor,omitempty" json:"-"` // 仅对自己删除的用户
+    SearchTokens     []string            `bson:"searchTokens,omitempty" json:"-"` // 全文检索 n-gram 索引词
+    SearchVersion    int                 `bson:"searchVersion,omitempty" json:"-"` // 生成 searchTokens 的规则版本（search.Version）
     CreatedAt        time.Time           `bson:"createdAt" json:"created_at"`
     UpdatedAt        time.Time           `bson:"updatedAt" json:"updated_at"`
-    DeletedAt        *time.Time          `bson:"deletedAt" json:"deleted_at"`
+    DeletedAt        *time.Time          `bson:"deletedAt" json:"deleted_at"` // 撤回时间，非空即为墓碑消息
+}
+
+// ForwardInfo 逐条转发时记录的原消息来源，保留原发送者与角色信息。
+type ForwardInfo struct {
+    ConversationId string         `bson:"conversationId" json:"conversation_id"`
+    Seq            int64          `bson:"seq" json:"seq"`
+    SenderUserId   string         `bson:"senderUserId" json:"sender_user_id"`
+    CharacterInfo  *CharacterInfo `bson:"characterInfo,omitempty" json:"character_info,omitempty"`
+    CreatedAt      time.Time      `bson:"createdAt" json:"created_at"`
+}
+
+// MessageStar 用户收藏（星标）的消息；被收藏的消息不受保留期清理。
+type MessageStar struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    Seq            int64              `bson:"seq" json:"seq"`
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// LegalHold 管理员对会话设置的法律保全，保全期间该会话消息不会被清理。
+type LegalHold struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    Reason         string             `bson:"reason" json:"reason"`
+    CreatedBy      string             `bson:"createdBy" json:"created_by"`
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// ArchivedMessage 超过保留期后移入 messages_archive 的消息，保留原 _id。
+type ArchivedMessage struct {
+    Message    `bson:",inline"`
+    ArchivedAt time.Time `bson:"archivedAt" json:"archived_at"`
+}
+
+// ScheduledMessage 定时消息：到点后由后台任务经正常发送流程投递并获得真实 seq。
+type ScheduledMessage struct {
+    ID               primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+    SenderUserId     string                 `bson:"senderUserId" json:"sender_user_id"`
+    ConversationType string                 `bson:"conversationType" json:"conversation_type"`
+    ConversationId   string                 `bson:"conversationId" json:"conversation_id"`
+    MessageType      string                 `bson:"messageType" json:"message_type"`
+    Element          map[string]interface{} `bson:"element" json:"element"`
+    CharacterId      string                 `bson:"characterId,omitempty" json:"character_id,omitempty"`
+    ReplyToSeq       int64                  `bson:"replyToSeq,omitempty" json:"reply_to_seq,omitempty"`
+    Mentions         []string               `bson:"mentions,omitempty" json:"mentions,omitempty"`
+    MentionAll       bool                   `bson:"mentionAll,omitempty" json:"mention_all,omitempty"`
+    SendAt           time.Time              `bson:"sendAt" json:"send_at"`
+    Status           string                 `bson:"status" json:"status"` // pending 待发送 / sending 投递中 / sent 已发送 / failed 失败 / canceled 已取消
+    Attempts         int                    `bson:"attempts" json:"attempts"`
+    LastError        string                 `bson:"lastError,omitempty" json:"last_error,omitempty"`
+    LockedUntil      *time.Time             `bson:"lockedUntil,omitempty" json:"-"` // 投递中的租约，进程崩溃后可被重新领取
+    MessageSeq       int64                  `bson:"messageSeq,omitempty" json:"message_seq,omitempty"`
+    SentAt           *time.Time             `bson:"sentAt,omitempty" json:"sent_at,omitempty"`
+    CreatedAt        time.Time              `bson:"createdAt" json:"created_at"`
+    UpdatedAt        time.Time              `bson:"updatedAt" json:"updated_at"`
+}
+
+// MessageQuote 被回复消息的精简预览，不落库，由查询接口按 replyToSeq 填充。
+type MessageQuote struct {
+    Seq           int64          `json:"seq"`
+    SenderUserId  string         `json:"sender_user_id"`
+    CharacterInfo *CharacterInfo `json:"character_info,omitempty"`
+    Preview       string         `json:"preview"`
+    Recalled      bool           `json:"recalled"`
+}
+
+// MessageReaction 用户对消息的一个表情回应，单独成文档以避免并发改写 Message。
+type MessageReaction struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    Seq            int64              `bson:"seq" json:"seq"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    Emoji          string             `bson:"emoji" json:"emoji"`
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// ReactionCount 某表情在一条消息上的聚合结果。
+type ReactionCount struct {
+    Emoji       string `bson:"emoji" json:"emoji"`
+    Count       int64  `bson:"count" json:"count"`
+    ReactedByMe bool   `bson:"reactedByMe" json:"reacted_by_me"`
+}
+
+// ReactionChange 表情回应变更事件的内容，Count 为变更后的该表情总数。
+type ReactionChange struct {
+    Emoji  string `bson:"emoji" json:"emoji"`
+    Action string `bson:"action" json:"action"` // add 添加 / remove 取消
+    Count  int64  `bson:"count" json:"count"`
+}
+
+// MessageEdit 消息被编辑前的内容快照。
+type MessageEdit struct {
+    Element  MessageElement `bson:"element" json:"element"`
+    EditedAt time.Time      `bson:"editedAt" json:"edited_at"`
+}
+
+// MessageEvent 消息变更事件（撤回/编辑/删除），按会话内 eventSeq 递增，供客户端增量同步。
+type MessageEvent struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    EventSeq       int64              `bson:"eventSeq" json:"event_seq"`
+    Type           string             `bson:"type" json:"type"` // recall 撤回 / edit 编辑 / delete 仅自己删除 / reaction 表情回应 / pin、unpin 置顶消息 / settings 个人设置（仅旧数据，现由 user_conversations.settingsSeq 同步）
+    Seq            int64              `bson:"seq" json:"seq"`
+    OperatorId     string             `bson:"operatorId" json:"operator_id"`
+    VisibleTo      string             `bson:"visibleTo,omitempty" json:"visible_to,omitempty"` // 非空时仅该用户可见
+    Element        *MessageElement    `bson:"element,omitempty" json:"element,omitempty"`
+    Reaction       *ReactionChange    `bson:"reaction,omitempty" json:"reaction,omitempty"`
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
 }
 
 type MessageElement struct {
-    Type string                 `bson:"type" json:"type"`
-    Data map[string]interface{} `bson:"data" json:"data"`
+    Type       string                 `bson:"type" json:"type"`
+    Data       map[string]interface{} `bson:"data" json:"data"`
+    Mentions   []string               `bson:"mentions,omitempty" json:"mentions,omitempty"`        // 被 @ 的用户ID
+    MentionAll bool                   `bson:"mentionAll,omitempty" json:"mention_all,omitempty"`   // @全体成员
+}
+
+// Mention 用户被 @ 的消息索引，用于跳转到未读提及；已读游标越过后删除。
+type Mention struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    Seq            int64              `bson:"seq" json:"seq"`
+    SenderUserId   string             `bson:"senderUserId" json:"sender_user_id"`
+    All            bool               `bson:"all" json:"all"` // 来自 @全体成员
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// Notification 用户通知流（目前仅 @提及），按 _id 倒序分页。
+type Notification struct {
+    ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserId           string             `bson:"userId" json:"user_id"`
+    Type             string             `bson:"type" json:"type"` // mention
+    ConversationId   string             `bson:"conversationId" json:"conversation_id"`
+    ConversationType string             `bson:"conversationType" json:"conversation_type"`
+    Seq              int64              `bson:"seq" json:"seq"`
+    SenderUserId     string             `bson:"senderUserId" json:"sender_user_id"`
+    Preview          string             `bson:"preview" json:"preview"`
+    ReadAt           *time.Time         `bson:"readAt" json:"read_at"`
+    CreatedAt        time.Time          `bson:"createdAt" json:"created_at"`
 }
 
 type CharacterInfo struct {
@@ -0,0 +1,181 @@
+package realtime
+
+import (
+    "context"
+    "sync"
+)
+
+// subscriptionBuffer 单个订阅的事件缓冲，写满说明客户端消费过慢，将被断开。
+const subscriptionBuffer = 64
+
+// Event 推送给在线客户端的实时事件；ID 形如 "<conversationId>:<seq>"，供 SSE 断线续传。
+type Event struct {
+    ID   string `json:"id,omitempty"`
+    Type string `json:"type"`
+    Data any    `json:"data"`
+}
+
+// Subscription 一个在线连接对某用户事件的订阅；同一用户可同时持有多个订阅。
+type Subscription struct {
+    userId    string
+    sessionId string
+    hub       *hub
+    ch        chan Event
+    once      sync.Once
+}
+
+// C 返回事件通道；通道关闭表示订阅已被服务端终止（慢消费或停机）。
+func (s *Subscription) C() <-chan Event { return s.ch }
+
+// UserId 返回订阅所属用户。
+func (s *Subscription) UserId() string { return s.userId }
+
+// Close 释放订阅，连接断开时必须调用。
+func (s *Subscription) Close() { s.hub.remove(s) }
+
+type hub struct {
+    mu        sync.Mutex
+    subs      map[string]map[*Subscription]struct{}
+    bySession map[string]map[*Subscription]struct{}
+    closed    bool
+    wg        sync.WaitGroup
+}
+
+var defaultHub = newHub()
+
+func newHub() *hub {
+    return &hub{subs: make(map[string]map[*Subscription]struct{}), bySession: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe 为用户注册一个新的订阅，sessionId 为连接所用令牌所属的登录会话，会话被吊销时由 CloseSessions 断开；
+// 停机后返回的订阅通道已关闭。
+func Subscribe(userId, sessionId string) *Subscription {
+    return defaultHub.subscribe(userId, sessionId)
+}
+
+func (h *hub) subscribe(userId, sessionId string) *Subscription {
+    s := &Subscription{userId: userId, sessionId: sessionId, hub: h, ch: make(chan Event, subscriptionBuffer)}
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.closed {
+        s.once.Do(func() { close(s.ch) })
+        return s
+    }
+    addTo(h.subs, userId, s)
+    if sessionId != "" {
+        addTo(h.bySession, sessionId, s)
+    }
+    h.wg.Add(1)
+    return s
+}
+
+func addTo(index map[string]map[*Subscription]struct{}, key string, s *Subscription) {
+    set, ok := index[key]
+    if !ok {
+        set = make(map[*Subscription]struct{})
+        index[key] = set
+    }
+    set[s] = struct{}{}
+}
+
+// CloseSessions 断开属于指定登录会话的全部订阅（会话吊销、登出时调用）。
+func CloseSessions(sessionIds ...string) {
+    defaultHub.closeSessions(sessionIds...)
+}
+
+func (h *hub) closeSessions(sessionIds ...string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    for _, sid := range sessionIds {
+        for s := range h.bySession[sid] {
+            h.removeLocked(s)
+        }
+    }
+}
+
+// Publish 将事件投递给指定用户的全部在线订阅，不会阻塞调用方。
+func Publish(userIds []string, ev Event) {
+    defaultHub.publish(userIds, ev)
+}
+
+func (h *hub) publish(userIds []string, ev Event) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.closed {
+        return
+    }
+    seen := make(map[string]struct{}, len(userIds))
+    for _, uid := range userIds {
+        if _, dup := seen[uid]; dup {
+            continue
+        }
+        seen[uid] = struct{}{}
+        for s := range h.subs[uid] {
+            select {
+            case s.ch <- ev:
+            default:
+                // 缓冲已满：断开并移除该订阅（之后不会再向已关闭的通道投递），由客户端重连后通过历史接口补齐
+                h.removeLocked(s)
+            }
+        }
+    }
+}
+
+// Shutdown 关闭全部订阅通道并等待各连接释放订阅，超时以 ctx 为准。
+func Shutdown(ctx context.Context) error {
+    return defaultHub.shutdown(ctx)
+}
+
+func (h *hub) shutdown(ctx context.Context) error {
+    h.mu.Lock()
+    if !h.closed {
+        h.closed = true
+        for _, set := range h.subs {
+            for s := range set {
+                s.once.Do(func() { close(s.ch) })
+            }
+        }
+    }
+    h.mu.Unlock()
+
+    done := make(chan struct{})
+    go func() {
+        h.wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (h *hub) remove(s *Subscription) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.removeLocked(s)
+}
+
+// removeLocked 移除订阅并关闭其通道，调用方须持有 h.mu；重复调用无副作用。
+func (h *hub) removeLocked(s *Subscription) {
+    set, ok := h.subs[s.userId]
+    if !ok {
+        return
+    }
+    if _, ok := set[s]; !ok {
+        return
+    }
+    delete(set, s)
+    if len(set) == 0 {
+        delete(h.subs, s.userId)
+    }
+    if bs := h.bySession[s.sessionId]; bs != nil {
+        delete(bs, s)
+        if len(bs) == 0 {
+            delete(h.bySession, s.sessionId)
+        }
+    }
+    s.once.Do(func() { close(s.ch) })
+    h.wg.Done()
+}
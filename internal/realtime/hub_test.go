@@ -0,0 +1,121 @@
+package realtime
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// drain 读出通道中已缓冲的事件，返回数量与通道是否已关闭。
+func drain(s *Subscription) (n int, closed bool) {
+    for {
+        select {
+        case _, ok := <-s.C():
+            if !ok {
+                return n, true
+            }
+            n++
+        default:
+            return n, false
+        }
+    }
+}
+
+func TestPublishDelivers(t *testing.T) {
+    h := newHub()
+    a1 := h.subscribe("a", "s1")
+    a2 := h.subscribe("a", "s2")
+    b := h.subscribe("b", "s3")
+    defer a1.Close()
+    defer a2.Close()
+    defer b.Close()
+
+    // 重复的用户ID只投递一次
+    h.publish([]string{"a", "a"}, Event{Type: "message.new"})
+    for _, s := range []*Subscription{a1, a2} {
+        if n, closed := drain(s); n != 1 || closed {
+            t.Errorf("subscription of a: got %d events (closed=%v), want 1", n, closed)
+        }
+    }
+    if n, _ := drain(b); n != 0 {
+        t.Errorf("subscription of b: got %d events, want 0", n)
+    }
+}
+
+func TestPublishOverflowRemovesSubscription(t *testing.T) {
+    h := newHub()
+    slow := h.subscribe("a", "s1")
+    fast := h.subscribe("a", "s2")
+    defer fast.Close()
+
+    for i := 0; i < subscriptionBuffer; i++ {
+        h.publish([]string{"a"}, Event{Type: "message.new"})
+        drain(fast)
+    }
+    // 缓冲已满的订阅在下一次投递时被断开并移除，其余订阅不受影响
+    h.publish([]string{"a"}, Event{Type: "message.new"})
+    if n, closed := drain(slow); n != subscriptionBuffer || !closed {
+        t.Errorf("slow subscription: got %d events (closed=%v), want %d then closed", n, closed, subscriptionBuffer)
+    }
+    if n, closed := drain(fast); n != 1 || closed {
+        t.Errorf("fast subscription: got %d events (closed=%v), want 1", n, closed)
+    }
+    h.mu.Lock()
+    _, stillIndexed := h.subs["a"][slow]
+    _, stillInSession := h.bySession["s1"]
+    h.mu.Unlock()
+    if stillIndexed || stillInSession {
+        t.Error("overflowed subscription still registered")
+    }
+    // 之后的投递与客户端的 Close 都不会向已关闭通道写入或重复释放
+    h.publish([]string{"a"}, Event{Type: "message.new"})
+    slow.Close()
+    fast.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    if err := h.shutdown(ctx); err != nil {
+        t.Errorf("shutdown: %v", err)
+    }
+}
+
+func TestCloseSessions(t *testing.T) {
+    h := newHub()
+    s1a := h.subscribe("a", "s1")
+    s1b := h.subscribe("a", "s1")
+    s2 := h.subscribe("a", "s2")
+    defer s2.Close()
+
+    h.closeSessions("s1", "unknown")
+    for _, s := range []*Subscription{s1a, s1b} {
+        if _, closed := drain(s); !closed {
+            t.Error("subscription of revoked session still open")
+        }
+    }
+    h.publish([]string{"a"}, Event{Type: "message.new"})
+    if n, closed := drain(s2); n != 1 || closed {
+        t.Errorf("other session: got %d events (closed=%v), want 1", n, closed)
+    }
+    s1a.Close()
+}
+
+func TestShutdown(t *testing.T) {
+    h := newHub()
+    s := h.subscribe("a", "s1")
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    // 订阅未释放时等待到超时
+    if err := h.shutdown(ctx); err != context.DeadlineExceeded {
+        t.Errorf("shutdown with open subscription: err = %v, want deadline exceeded", err)
+    }
+    if _, closed := drain(s); !closed {
+        t.Error("subscription channel not closed on shutdown")
+    }
+    s.Close()
+    if err := h.shutdown(context.Background()); err != nil {
+        t.Errorf("shutdown after release: %v", err)
+    }
+    // 停机后的新订阅直接返回已关闭的通道
+    if _, closed := drain(h.subscribe("b", "s2")); !closed {
+        t.Error("subscribe after shutdown returned an open channel")
+    }
+}
@@ -2,6 +2,9 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"roleplay/internal/config"
 
 	"roleplay/internal/controller"
 	"roleplay/internal/middleware"
@@ -10,6 +13,10 @@ import (
 // New 返回一个注册好全部路由的 gin.Engine。
 func New() *gin.Engine {
 	r := gin.New()
+	// 未配置可信代理时不信任 X-Forwarded-For，避免客户端伪造IP绕过按IP的限流
+	if err := r.SetTrustedProxies(config.C.Server.TrustedProxies); err != nil {
+		zap.L().Warn("invalid trusted proxies", zap.Error(err))
+	}
 	r.Use(gin.Recovery())
 	// 静态资源：头像等
 	r.Static("/static", "./uploads")
@@ -23,12 +30,19 @@ func New() *gin.Engine {
 	r.POST("/api/user/oneclick_login", controller.OneClickLogin)
 	r.POST("/api/auth/refresh", controller.RefreshToken)
 
+	// Realtime 实时推送（握手时自行校验令牌，便于浏览器通过查询参数携带）
+	r.GET("/ws", controller.ServeWS)
+
 	// Protected group 需鉴权接口
 	auth := r.Group("/api", middleware.AuthMiddleware())
 
 	// User 用户模块
 	auth.GET("/user/me", controller.GetMe)
 	auth.PUT("/user/me", controller.UpdateMe)
+	auth.GET("/user/sessions", controller.ListSessions)
+	auth.POST("/user/sessions/revoke", controller.RevokeSession)
+	auth.POST("/user/sessions/revoke_others", controller.RevokeOtherSessions)
+	auth.POST("/user/logout", controller.Logout)
 
 	// Relation 好友与黑名单
 	auth.POST("/relation/friend/request", controller.CreateFriendRequest)
@@ -51,6 +65,42 @@ func New() *gin.Engine {
 	// Messaging 消息模块
 	auth.POST("/message/send", controller.SendMessage)
 	auth.GET("/message/history", controller.GetMessageHistory)
+	auth.POST("/message/recall", controller.RecallMessage)
+	auth.POST("/message/edit", controller.EditMessage)
+	auth.POST("/message/delete", controller.DeleteMessageForMe)
+	auth.POST("/message/forward", controller.ForwardMessages)
+	auth.POST("/message/star", controller.StarMessage)
+	auth.POST("/message/unstar", controller.UnstarMessage)
+	auth.GET("/message/starred", controller.ListStarredMessages)
+	auth.POST("/message/schedule", controller.ScheduleMessage)
+	auth.GET("/message/scheduled", controller.ListScheduledMessages)
+	auth.POST("/message/scheduled/edit", controller.EditScheduledMessage)
+	auth.POST("/message/scheduled/cancel", controller.CancelScheduledMessage)
+	auth.GET("/message/replies", controller.ListReplies)
+	auth.POST("/message/reaction/add", controller.AddReaction)
+	auth.POST("/message/reaction/remove", controller.RemoveReaction)
+	auth.GET("/message/search", controller.SearchMessages)
+	auth.POST("/message/sync", controller.SyncMessages)
+
+	// Conversation 会话列表与已读回执
+	auth.GET("/conversation/list", controller.ListConversations)
+	auth.POST("/conversation/dm", controller.OpenDMConversation)
+	auth.POST("/conversation/read", controller.MarkConversationRead)
+	auth.GET("/conversation/read_status", controller.GetReadStatus)
+	auth.GET("/conversation/read_count", controller.GetReadCount)
+	auth.GET("/conversation/mentions", controller.ListUnreadMentions)
+	auth.GET("/conversation/export", controller.ExportConversation)
+	auth.POST("/conversation/settings", controller.UpdateConversationSettings)
+	auth.POST("/conversation/pin_message", controller.PinMessage)
+	auth.POST("/conversation/unpin_message", controller.UnpinMessage)
+	auth.GET("/conversation/pinned_messages", controller.ListPinnedMessages)
+
+	// Notification 通知（@提及）
+	auth.GET("/notification/list", controller.ListNotifications)
+	auth.POST("/notification/read", controller.MarkNotificationsRead)
+
+	// Stream SSE 实时推送（WebSocket 降级方案）
+	auth.GET("/stream", controller.StreamEvents)
 
 	// Room 演绎房间
 	auth.POST("/room/join", controller.JoinRoom)
@@ -72,5 +122,11 @@ func New() *gin.Engine {
 	auth.GET("/user/activities/:user_id", controller.GetUserActivities)
 	auth.POST("/user/heartbeat", controller.UserHeartbeat)
 
+	// Admin 管理接口（config admin.user_ids）
+	admin := auth.Group("/admin", middleware.AdminOnly())
+	admin.POST("/legal_hold", controller.SetLegalHold)
+	admin.DELETE("/legal_hold/:conversation_id", controller.ReleaseLegalHold)
+	admin.GET("/legal_holds", controller.ListLegalHolds)
+
 	return r
 }
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/config"
+    "roleplay/internal/model"
+    "roleplay/internal/repository"
+)
+
+// retentionBatch 每批处理的过期消息数。
+const retentionBatch = 500
+
+// RunRetention 周期性清理超过保留期的消息，阻塞直至 ctx 取消。
+// 被任意用户收藏的消息与处于法律保全中的会话不受影响。
+func RunRetention(ctx context.Context, interval time.Duration) {
+    if interval <= 0 { interval = time.Hour }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        for _, t := range []string{"dm", "group", "room"} {
+            days := config.RetentionDays(t)
+            if days <= 0 || ctx.Err() != nil { continue }
+            n, err := sweepExpired(ctx, t, time.Now().AddDate(0, 0, -days), config.C.Retention.Mode != "delete")
+            if err != nil && ctx.Err() == nil {
+                zap.L().Error("retention sweep", zap.String("conversationType", t), zap.Error(err))
+            }
+            if n > 0 { zap.L().Info("retention sweep", zap.String("conversationType", t), zap.Int("removed", n)) }
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// sweepExpired 分批处理某会话类型中 cutoff 之前的消息：archive 为 true 时先写入 messages_archive 再删除。
+func sweepExpired(ctx context.Context, convType string, cutoff time.Time, archive bool) (int, error) {
+    db := repository.DB()
+    held, err := heldConversations(ctx)
+    if err != nil { return 0, err }
+    filter := bson.M{"conversationType": convType, "createdAt": bson.M{"$lt": cutoff}}
+    if len(held) > 0 { filter["conversationId"] = bson.M{"$nin": held} }
+    removed := 0
+    var lastId primitive.ObjectID
+    for ctx.Err() == nil {
+        if !lastId.IsZero() { filter["_id"] = bson.M{"$gt": lastId} }
+        cur, err := db.Collection("messages").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(retentionBatch))
+        if err != nil { return removed, err }
+        var list []model.Message
+        if err := cur.All(ctx, &list); err != nil { return removed, err }
+        if len(list) == 0 { break }
+        lastId = list[len(list)-1].ID
+        expired, err := withoutStarred(ctx, list)
+        if err != nil { return removed, err }
+        if len(expired) > 0 {
+            n, err := removeMessages(ctx, expired, archive)
+            removed += n
+            if err != nil { return removed, err }
+        }
+        if len(list) < retentionBatch { break }
+    }
+    return removed, nil
+}
+
+// heldConversations 返回处于法律保全中的会话ID。
+func heldConversations(ctx context.Context) ([]string, error) {
+    cur, err := repository.DB().Collection("legal_holds").Find(ctx, bson.M{})
+    if err != nil { return nil, err }
+    var holds []model.LegalHold
+    if err := cur.All(ctx, &holds); err != nil { return nil, err }
+    ids := make([]string, 0, len(holds))
+    for _, h := range holds { ids = append(ids, h.ConversationId) }
+    return ids, nil
+}
+
+// withoutStarred 过滤掉被任意用户收藏的消息。
+func withoutStarred(ctx context.Context, list []model.Message) ([]model.Message, error) {
+    or := make([]bson.M, 0, len(list))
+    for _, m := range list { or = append(or, bson.M{"conversationId": m.ConversationId, "seq": m.Seq}) }
+    cur, err := repository.DB().Collection("message_stars").Find(ctx, bson.M{"$or": or})
+    if err != nil { return nil, err }
+    var stars []model.MessageStar
+    if err := cur.All(ctx, &stars); err != nil { return nil, err }
+    starred := make(map[string]bool, len(stars))
+    for _, s := range stars { starred[fmt.Sprintf("%s:%d", s.ConversationId, s.Seq)] = true }
+    out := make([]model.Message, 0, len(list))
+    for _, m := range list {
+        if !starred[fmt.Sprintf("%s:%d", m.ConversationId, m.Seq)] { out = append(out, m) }
+    }
+    return out, nil
+}
+
+// messageRelatedCollections 以 (conversationId, seq) 关联消息的集合，消息删除时一并清理。
+var messageRelatedCollections = []string{"message_reactions", "mentions", "notifications", "message_stars", "message_events"}
+
+// removeMessages 归档（可选）并删除消息及其表情回应、提及、通知、收藏与变更事件；
+// 归档保留原 _id，重复执行时已归档的条目按重复键跳过。关联数据先于消息删除，中途失败时下次执行仍能找到并补删。
+func removeMessages(ctx context.Context, list []model.Message, archive bool) (int, error) {
+    db := repository.DB()
+    ids := make([]primitive.ObjectID, 0, len(list))
+    for _, m := range list { ids = append(ids, m.ID) }
+    if archive {
+        now := time.Now()
+        docs := make([]interface{}, 0, len(list))
+        for _, m := range list { docs = append(docs, model.ArchivedMessage{Message: m, ArchivedAt: now}) }
+        if _, err := db.Collection("messages_archive").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil && !onlyDuplicateKeys(err) {
+            return 0, err
+        }
+    }
+    if filter := relatedFilter(list); filter != nil {
+        for _, name := range messageRelatedCollections {
+            if _, err := db.Collection(name).DeleteMany(ctx, filter); err != nil { return 0, err }
+        }
+    }
+    res, err := db.Collection("messages").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+    if err != nil { return 0, err }
+    return int(res.DeletedCount), nil
+}
+
+// relatedFilter 按会话分组构造关联数据的删除条件 {$or: [{conversationId, seq: {$in}}...]}，list 为空时返回 nil。
+func relatedFilter(list []model.Message) bson.M {
+    seqs := map[string][]int64{}
+    var convIds []string
+    for _, m := range list {
+        if _, ok := seqs[m.ConversationId]; !ok { convIds = append(convIds, m.ConversationId) }
+        seqs[m.ConversationId] = append(seqs[m.ConversationId], m.Seq)
+    }
+    if len(convIds) == 0 { return nil }
+    or := make([]bson.M, 0, len(convIds))
+    for _, id := range convIds {
+        or = append(or, bson.M{"conversationId": id, "seq": bson.M{"$in": seqs[id]}})
+    }
+    return bson.M{"$or": or}
+}
+
+// onlyDuplicateKeys 批量写入的错误是否全部为重复键（即这些消息此前已归档）。
+func onlyDuplicateKeys(err error) bool {
+    var bwe mongo.BulkWriteException
+    if !errors.As(err, &bwe) || bwe.WriteConcernError != nil { return false }
+    for _, we := range bwe.WriteErrors {
+        if we.Code != 11000 { return false }
+    }
+    return true
+}
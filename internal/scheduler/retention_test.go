@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+    "reflect"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+
+    "roleplay/internal/model"
+)
+
+func TestRelatedFilter(t *testing.T) {
+    if f := relatedFilter(nil); f != nil {
+        t.Errorf("relatedFilter(nil) = %v, want nil", f)
+    }
+    list := []model.Message{
+        {ConversationId: "c1", Seq: 3},
+        {ConversationId: "c2", Seq: 7},
+        {ConversationId: "c1", Seq: 5},
+    }
+    want := bson.M{"$or": []bson.M{
+        {"conversationId": "c1", "seq": bson.M{"$in": []int64{3, 5}}},
+        {"conversationId": "c2", "seq": bson.M{"$in": []int64{7}}},
+    }}
+    if got := relatedFilter(list); !reflect.DeepEqual(got, want) {
+        t.Errorf("relatedFilter = %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.uber.org/zap"
+
+    "roleplay/internal/model"
+    "roleplay/internal/realtime"
+    "roleplay/internal/repository"
+)
+
+const (
+    // leaseDuration 单条定时消息的投递租约，超时未完成视为进程异常，可被重新领取
+    leaseDuration = time.Minute
+    // maxAttempts 临时错误的最大重试次数
+    maxAttempts = 5
+    // batchSize 每轮最多投递的条数，避免积压时单轮耗时过长
+    batchSize = 100
+)
+
+// ErrPermanent 标记不可重试的投递错误（无权限、内容不合法等），定时消息直接置为 failed。
+var ErrPermanent = errors.New("permanent delivery error")
+
+// DeliverFunc 投递一条到期的定时消息，返回其在会话中分配的 seq。
+type DeliverFunc func(ctx context.Context, sm model.ScheduledMessage) (int64, error)
+
+// RunScheduledMessages 周期性领取到期的定时消息并投递，阻塞直至 ctx 取消。
+func RunScheduledMessages(ctx context.Context, interval time.Duration, deliver DeliverFunc) {
+    if interval <= 0 { interval = 5 * time.Second }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        for i := 0; i < batchSize && ctx.Err() == nil; i++ {
+            sm, err := claimDue(ctx)
+            if err == mongo.ErrNoDocuments { break }
+            if err != nil {
+                if ctx.Err() == nil { zap.L().Error("claim scheduled message", zap.Error(err)) }
+                break
+            }
+            process(ctx, sm, deliver)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// claimDue 原子地领取一条到期的待发送消息（或租约已过期的投递中消息）。
+func claimDue(ctx context.Context) (model.ScheduledMessage, error) {
+    now := time.Now()
+    lease := now.Add(leaseDuration)
+    var sm model.ScheduledMessage
+    err := repository.DB().Collection("scheduled_messages").FindOneAndUpdate(ctx,
+        bson.M{"$or": []bson.M{
+            {"status": "pending", "sendAt": bson.M{"$lte": now}},
+            {"status": "sending", "lockedUntil": bson.M{"$lt": now}},
+        }},
+        bson.M{"$set": bson.M{"status": "sending", "lockedUntil": lease, "updatedAt": now}, "$inc": bson.M{"attempts": 1}},
+        options.FindOneAndUpdate().SetSort(bson.D{{Key: "sendAt", Value: 1}}).SetReturnDocument(options.After),
+    ).Decode(&sm)
+    return sm, err
+}
+
+// process 投递并记录结果；临时错误按指数退避放回队列，超过重试次数或永久错误置为 failed 并通知发送者。
+func process(ctx context.Context, sm model.ScheduledMessage, deliver DeliverFunc) {
+    coll := repository.DB().Collection("scheduled_messages")
+    seq, err := deliver(ctx, sm)
+    now := time.Now()
+    filter := bson.M{"_id": sm.ID, "status": "sending"}
+    if err == nil {
+        sm.Status, sm.MessageSeq, sm.SentAt = "sent", seq, &now
+        _, _ = coll.UpdateOne(ctx, filter, bson.M{
+            "$set":   bson.M{"status": "sent", "messageSeq": seq, "sentAt": now, "updatedAt": now},
+            "$unset": bson.M{"lockedUntil": "", "lastError": ""},
+        })
+        realtime.Publish([]string{sm.SenderUserId}, realtime.Event{Type: "scheduled.sent", Data: sm})
+        return
+    }
+    if ctx.Err() != nil {
+        // 停机中断：保持 sending，租约到期后重新领取（client_msg_id 保证不会重复发送）
+        return
+    }
+    zap.L().Warn("deliver scheduled message", zap.String("id", sm.ID.Hex()), zap.Int("attempts", sm.Attempts), zap.Error(err))
+    if errors.Is(err, ErrPermanent) || sm.Attempts >= maxAttempts {
+        sm.Status, sm.LastError = "failed", err.Error()
+        _, _ = coll.UpdateOne(ctx, filter, bson.M{
+            "$set":   bson.M{"status": "failed", "lastError": sm.LastError, "updatedAt": now},
+            "$unset": bson.M{"lockedUntil": ""},
+        })
+        realtime.Publish([]string{sm.SenderUserId}, realtime.Event{Type: "scheduled.failed", Data: sm})
+        return
+    }
+    retryAt := now.Add(time.Duration(1<<sm.Attempts) * 10 * time.Second)
+    _, _ = coll.UpdateOne(ctx, filter, bson.M{
+        "$set":   bson.M{"status": "pending", "sendAt": retryAt, "lastError": err.Error(), "updatedAt": now},
+        "$unset": bson.M{"lockedUntil": ""},
+    })
+}
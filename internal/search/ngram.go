@@ -0,0 +1,84 @@
+package search
+
+import (
+    "strings"
+    "unicode"
+)
+
+// Version 索引词生成规则的版本，规则变化时递增；消息记录生成时的版本，后台任务据此重建旧消息的索引词。
+// 版本 2 起拉丁字母数字词也按 n-gram 切分，以支持前缀与子串检索。
+const Version = 2
+
+// Tokens 生成消息文本的索引词：中日韩片段与字母数字词（小写）均取单字与相邻二元组（n-gram），
+// 因此可按任意子串检索。MongoDB 默认文本索引按空格分词，无法处理中文与子串。
+func Tokens(text string) []string {
+    return tokenize(text, true)
+}
+
+// QueryTokens 生成检索词：中日韩片段或字母数字词长度不小于 2 时只取二元组，单字时取该字本身；
+// 检索结果需再以原文子串匹配过滤，以排除二元组拼接带来的误命中。
+func QueryTokens(query string) []string {
+    return tokenize(query, false)
+}
+
+// Match 判断文本是否包含查询串（忽略大小写）。
+func Match(text, query string) bool {
+    return strings.Contains(strings.ToLower(text), strings.ToLower(strings.TrimSpace(query)))
+}
+
+func tokenize(text string, forIndex bool) []string {
+    seen := map[string]struct{}{}
+    var out []string
+    add := func(t string) {
+        if _, ok := seen[t]; !ok {
+            seen[t] = struct{}{}
+            out = append(out, t)
+        }
+    }
+    // 中日韩片段与字母数字词分别累积，二者相邻时互为边界，二元组不跨越边界
+    var word []rune
+    var cjk []rune
+    ngrams := func(run []rune) {
+        switch {
+        case len(run) == 1:
+            add(string(run))
+        case len(run) > 1:
+            for i := 0; i < len(run); i++ {
+                if forIndex {
+                    add(string(run[i]))
+                }
+                if i+1 < len(run) {
+                    add(string(run[i : i+2]))
+                }
+            }
+        }
+    }
+    flushWord := func() {
+        ngrams(word)
+        word = word[:0]
+    }
+    flushCJK := func() {
+        ngrams(cjk)
+        cjk = cjk[:0]
+    }
+    for _, r := range strings.ToLower(text) {
+        switch {
+        case isCJK(r):
+            flushWord()
+            cjk = append(cjk, r)
+        case unicode.IsLetter(r) || unicode.IsDigit(r):
+            flushCJK()
+            word = append(word, r)
+        default:
+            flushWord()
+            flushCJK()
+        }
+    }
+    flushWord()
+    flushCJK()
+    return out
+}
+
+func isCJK(r rune) bool {
+    return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTokens(t *testing.T) {
+    cases := []struct {
+        text string
+        want []string
+    }{
+        {"", nil},
+        {"好", []string{"好"}},
+        {"你好", []string{"你", "你好", "好"}},
+        {"Hi", []string{"h", "hi", "i"}},
+        {"abc", []string{"a", "ab", "b", "bc", "c"}},
+        // 中文与字母数字相邻时互为边界，二元组不跨越
+        {"ok好", []string{"o", "ok", "k", "好"}},
+        // 标点与空白分隔，重复词只保留一次
+        {"a, a!", []string{"a"}},
+    }
+    for _, tc := range cases {
+        if got := Tokens(tc.text); !reflect.DeepEqual(got, tc.want) {
+            t.Errorf("Tokens(%q) = %v, want %v", tc.text, got, tc.want)
+        }
+    }
+}
+
+func TestQueryTokens(t *testing.T) {
+    cases := []struct {
+        query string
+        want  []string
+    }{
+        {"好", []string{"好"}},
+        {"你好吗", []string{"你好", "好吗"}},
+        {"x", []string{"x"}},
+        {"Hel", []string{"he", "el"}},
+        {"  ", nil},
+    }
+    for _, tc := range cases {
+        if got := QueryTokens(tc.query); !reflect.DeepEqual(got, tc.want) {
+            t.Errorf("QueryTokens(%q) = %v, want %v", tc.query, got, tc.want)
+        }
+    }
+}
+
+// 检索词须是索引词的子集，前缀与子串查询才能命中
+func TestQueryTokensSubsetOfIndex(t *testing.T) {
+    text := "Hello World 你好世界"
+    index := map[string]bool{}
+    for _, tok := range Tokens(text) {
+        index[tok] = true
+    }
+    for _, q := range []string{"hello", "hel", "ell", "o", "WORLD", "orl", "好世", "世"} {
+        for _, tok := range QueryTokens(q) {
+            if !index[tok] {
+                t.Errorf("query %q token %q not indexed", q, tok)
+            }
+        }
+        if !Match(text, q) {
+            t.Errorf("Match(%q, %q) = false", text, q)
+        }
+    }
+}
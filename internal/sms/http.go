@@ -0,0 +1,58 @@
+package sms
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+
+    "roleplay/internal/config"
+)
+
+// HTTPSender 通过 HTTP 网关发送短信：POST JSON 到 Endpoint，2xx 视为成功。
+type HTTPSender struct {
+    Endpoint   string
+    APIKey     string
+    SignName   string
+    TemplateId string
+    Client     *http.Client
+}
+
+// NewHTTPSender 按 sms.http 配置创建网关通道。
+func NewHTTPSender() (*HTTPSender, error) {
+    c := config.C.SMS.HTTP
+    if c.Endpoint == "" { return nil, errors.New("sms.http.endpoint is required") }
+    return &HTTPSender{
+        Endpoint:   c.Endpoint,
+        APIKey:     c.APIKey,
+        SignName:   c.SignName,
+        TemplateId: c.TemplateId,
+        Client:     &http.Client{Timeout: config.SMSTimeout()},
+    }, nil
+}
+
+func (s *HTTPSender) Send(ctx context.Context, phone, code string) error {
+    body, err := json.Marshal(map[string]string{
+        "phone":       phone,
+        "code":        code,
+        "sign_name":   s.SignName,
+        "template_id": s.TemplateId,
+    })
+    if err != nil { return err }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    if s.APIKey != "" { req.Header.Set("Authorization", "Bearer "+s.APIKey) }
+    resp, err := s.Client.Do(req)
+    if err != nil { return fmt.Errorf("sms gateway: %w", err) }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        return fmt.Errorf("sms gateway: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+    }
+    _, _ = io.Copy(io.Discard, resp.Body)
+    return nil
+}
@@ -0,0 +1,86 @@
+package sms
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func newTestSender(url string) *HTTPSender {
+    return &HTTPSender{
+        Endpoint:   url,
+        APIKey:     "secret-key",
+        SignName:   "roleplay",
+        TemplateId: "tpl_login",
+        Client:     &http.Client{Timeout: 5 * time.Second},
+    }
+}
+
+func TestHTTPSenderSend(t *testing.T) {
+    var (
+        gotMethod, gotAuth, gotType string
+        gotBody                     map[string]string
+    )
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        gotMethod = r.Method
+        gotAuth = r.Header.Get("Authorization")
+        gotType = r.Header.Get("Content-Type")
+        if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+            t.Errorf("decode body: %v", err)
+        }
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer srv.Close()
+
+    if err := newTestSender(srv.URL).Send(context.Background(), "13800000000", "482913"); err != nil {
+        t.Fatalf("Send: %v", err)
+    }
+    if gotMethod != http.MethodPost {
+        t.Errorf("method = %q, want POST", gotMethod)
+    }
+    if gotAuth != "Bearer secret-key" {
+        t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer secret-key")
+    }
+    if gotType != "application/json" {
+        t.Errorf("Content-Type = %q, want application/json", gotType)
+    }
+    want := map[string]string{"phone": "13800000000", "code": "482913", "sign_name": "roleplay", "template_id": "tpl_login"}
+    for k, v := range want {
+        if gotBody[k] != v {
+            t.Errorf("body[%q] = %q, want %q", k, gotBody[k], v)
+        }
+    }
+}
+
+func TestHTTPSenderNoAPIKey(t *testing.T) {
+    var gotAuth string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        gotAuth = r.Header.Get("Authorization")
+    }))
+    defer srv.Close()
+
+    s := newTestSender(srv.URL)
+    s.APIKey = ""
+    if err := s.Send(context.Background(), "13800000000", "482913"); err != nil {
+        t.Fatalf("Send: %v", err)
+    }
+    if gotAuth != "" {
+        t.Errorf("Authorization = %q, want empty", gotAuth)
+    }
+}
+
+func TestHTTPSenderNon2xx(t *testing.T) {
+    for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError} {
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            http.Error(w, "quota exceeded", status)
+        }))
+        err := newTestSender(srv.URL).Send(context.Background(), "13800000000", "482913")
+        srv.Close()
+        if err == nil {
+            t.Errorf("status %d: Send returned nil error", status)
+        }
+    }
+}
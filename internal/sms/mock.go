@@ -0,0 +1,15 @@
+package sms
+
+import (
+    "context"
+
+    "go.uber.org/zap"
+)
+
+// MockSender 开发联调用：不真实发送，仅记录日志。
+type MockSender struct{}
+
+func (MockSender) Send(ctx context.Context, phone, code string) error {
+    zap.L().Info("mock sms sent", zap.String("phone", phone))
+    return nil
+}
@@ -0,0 +1,61 @@
+package sms
+
+import (
+    "context"
+    "crypto/rand"
+    "fmt"
+    "math/big"
+
+    "roleplay/internal/config"
+)
+
+// codeLength 随机验证码位数
+const codeLength = 6
+
+// Sender 短信通道：向手机号下发验证码。
+type Sender interface {
+    Send(ctx context.Context, phone, code string) error
+}
+
+var sender Sender
+
+// Init 按配置选择短信通道，须在处理请求前调用。
+func Init() error {
+    s, err := New()
+    if err != nil { return err }
+    sender = s
+    return nil
+}
+
+// New 按配置创建短信通道：mock 或 http。
+func New() (Sender, error) {
+    switch config.C.SMS.Provider {
+    case "", "mock":
+        return MockSender{}, nil
+    case "http":
+        return NewHTTPSender()
+    }
+    return nil, fmt.Errorf("unknown sms provider %q", config.C.SMS.Provider)
+}
+
+// Default 返回 Init 选定的短信通道，未初始化时使用 Mock。
+func Default() Sender {
+    if sender == nil { return MockSender{} }
+    return sender
+}
+
+// IsMock 判断是否为 Mock 通道：Mock 下使用固定验证码并允许在响应中回显。
+func IsMock(s Sender) bool {
+    _, ok := s.(MockSender)
+    return ok
+}
+
+// NewCode 生成验证码：Mock 通道使用配置的固定验证码，其它通道生成安全随机数字。
+func NewCode(s Sender) (string, error) {
+    if IsMock(s) && config.C.SMS.MockCode != "" { return config.C.SMS.MockCode, nil }
+    max := big.NewInt(1)
+    for i := 0; i < codeLength; i++ { max.Mul(max, big.NewInt(10)) }
+    n, err := rand.Int(rand.Reader, max)
+    if err != nil { return "", err }
+    return fmt.Sprintf("%0*d", codeLength, n), nil
+}
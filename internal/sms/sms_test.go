@@ -0,0 +1,98 @@
+package sms
+
+import (
+    "regexp"
+    "testing"
+
+    "roleplay/internal/config"
+)
+
+// withSMSConfig 临时替换短信配置，测试结束后还原。
+func withSMSConfig(t *testing.T, provider, mockCode, endpoint string) {
+    t.Helper()
+    saved := config.C.SMS
+    t.Cleanup(func() { config.C.SMS = saved })
+    config.C.SMS.Provider = provider
+    config.C.SMS.MockCode = mockCode
+    config.C.SMS.HTTP.Endpoint = endpoint
+}
+
+func TestNew(t *testing.T) {
+    cases := []struct {
+        provider, endpoint string
+        wantMock, wantErr  bool
+    }{
+        {"", "", true, false},
+        {"mock", "", true, false},
+        {"http", "https://sms.example.com/send", false, false},
+        {"http", "", false, true},
+        {"aliyun", "", false, true},
+    }
+    for _, tc := range cases {
+        withSMSConfig(t, tc.provider, "", tc.endpoint)
+        s, err := New()
+        if tc.wantErr {
+            if err == nil {
+                t.Errorf("provider %q endpoint %q: want error, got %T", tc.provider, tc.endpoint, s)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("provider %q: %v", tc.provider, err)
+            continue
+        }
+        if IsMock(s) != tc.wantMock {
+            t.Errorf("provider %q: IsMock = %v, want %v", tc.provider, IsMock(s), tc.wantMock)
+        }
+        if _, ok := s.(*HTTPSender); ok == tc.wantMock {
+            t.Errorf("provider %q: got %T", tc.provider, s)
+        }
+    }
+}
+
+func TestIsMock(t *testing.T) {
+    if !IsMock(MockSender{}) {
+        t.Error("IsMock(MockSender{}) = false")
+    }
+    if IsMock(&HTTPSender{}) {
+        t.Error("IsMock(*HTTPSender) = true")
+    }
+    if IsMock(nil) {
+        t.Error("IsMock(nil) = true")
+    }
+}
+
+var sixDigits = regexp.MustCompile(`^[0-9]{6}$`)
+
+func TestNewCode(t *testing.T) {
+    withSMSConfig(t, "mock", "123456", "")
+    if code, err := NewCode(MockSender{}); err != nil || code != "123456" {
+        t.Errorf("mock with fixed code: got %q, %v", code, err)
+    }
+    // 固定验证码只用于 Mock 通道，真实通道始终随机生成
+    code, err := NewCode(&HTTPSender{})
+    if err != nil || !sixDigits.MatchString(code) {
+        t.Errorf("http sender: got %q, %v", code, err)
+    }
+
+    config.C.SMS.MockCode = ""
+    if code, err := NewCode(MockSender{}); err != nil || !sixDigits.MatchString(code) {
+        t.Errorf("mock without fixed code: got %q, %v", code, err)
+    }
+}
+
+func TestDefault(t *testing.T) {
+    saved := sender
+    t.Cleanup(func() { sender = saved })
+    sender = nil
+    if !IsMock(Default()) {
+        t.Error("Default() before Init should be the mock sender")
+    }
+    withSMSConfig(t, "http", "", "https://sms.example.com/send")
+    if err := Init(); err != nil {
+        t.Fatalf("Init: %v", err)
+    }
+    if IsMock(Default()) {
+        t.Error("Default() after Init with http provider is mock")
+    }
+}